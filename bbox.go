@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	// maxBoxSuburbs caps the suburbs in one bounding box response.
+	maxBoxSuburbs = 200
+
+	defaultBoxAssets = 5
+	maxBoxAssets     = 20
+
+	// maxOpenBoxDegrees is the widest box, in either direction, that can be
+	// asked for without a limit. Wider boxes are capped at maxLargeBoxSuburbs,
+	// since zoomed out maps are served by clusters.
+	maxOpenBoxDegrees  = 1.0
+	maxLargeBoxSuburbs = 50
+)
+
+// BBox is an area between two latitudes and two longitudes.
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+func (b BBox) contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func (b BBox) center() (float64, float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLon + b.MaxLon) / 2
+}
+
+func (b BBox) large() bool {
+	return b.MaxLat-b.MinLat > maxOpenBoxDegrees || b.MaxLon-b.MinLon > maxOpenBoxDegrees
+}
+
+// BoxSuburb is a suburb inside a bounding box with the first of its assets.
+type BoxSuburb struct {
+	SuburbInfo
+	Assets      []Asset `json:"assets"`
+	TotalAssets int     `json:"totalAssets"`
+}
+
+// BoxFeed is the response of /newsfeed/bbox. Truncated is set when more
+// suburbs were inside the box than the limit allowed.
+type BoxFeed struct {
+	Suburbs   []BoxSuburb `json:"suburbs"`
+	Truncated bool        `json:"truncated"`
+}
+
+// bboxHandler serves /newsfeed/bbox, every suburb with a feed inside the box,
+// those nearest its center first.
+func (s *server) bboxHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	box, apiErr := parseBBox(query)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	limit, apiErr := parseBounded(query, "limit", maxBoxSuburbs)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	if box.large() && limit == 0 {
+		writeError(w, missingParameter("limit", fmt.Sprintf("boxes more than %v degrees across need a limit, or use /newsfeed/clusters", maxOpenBoxDegrees)))
+		return
+	}
+	if box.large() && limit > maxLargeBoxSuburbs {
+		writeError(w, invalidParameter("limit", fmt.Sprintf("boxes more than %v degrees across take a limit of at most %d, or use /newsfeed/clusters", maxOpenBoxDegrees, maxLargeBoxSuburbs)))
+		return
+	}
+	if limit == 0 {
+		limit = maxBoxSuburbs
+	}
+
+	assets, apiErr := parseBounded(query, "assets", maxBoxAssets)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if assets == 0 {
+		assets = defaultBoxAssets
+	}
+
+	filter, apiErr := parseAssetFilter(query, s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	locations, err := s.store.FeedsInBox(box)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	lat, lon := box.center()
+	sort.SliceStable(locations, func(i, j int) bool {
+		return distance(lat, lon, locations[i].Lat, locations[i].Lon) < distance(lat, lon, locations[j].Lat, locations[j].Lon)
+	})
+
+	feed := BoxFeed{Suburbs: []BoxSuburb{}}
+	if len(locations) > limit {
+		locations = locations[:limit]
+		feed.Truncated = true
+	}
+
+	for _, loc := range locations {
+		record, err := s.store.GetFeed(loc.Key())
+		if err != nil {
+			writeError(w, lookupError(err))
+			return
+		}
+
+		kept := filter.apply(record.Assets)
+		suburb := BoxSuburb{record.SuburbInfo, kept, len(kept)}
+		if len(suburb.Assets) > assets {
+			suburb.Assets = suburb.Assets[:assets]
+		}
+		feed.Suburbs = append(feed.Suburbs, suburb)
+	}
+
+	s.writeFeed(w, r, feed)
+}
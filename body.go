@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The ways an asset's body can be returned.
+const (
+	bodyFormatHTML     = "html"
+	bodyFormatResolved = "html-resolved"
+)
+
+// placeholderPattern matches the <x-placeholder id="..."> elements bodies
+// mark their embedded content with.
+var placeholderPattern = regexp.MustCompile(`(?s)<x-placeholder\s+id="([^"]*)"\s*(?:/>|>.*?</x-placeholder>)`)
+
+// BodyRenderer replaces the placeholders in asset bodies with HTML. Images
+// are served from ImageBaseURL followed by their file name; without it they
+// are left for clients to fetch by their data-image-id.
+type BodyRenderer struct {
+	ImageBaseURL string
+}
+
+// resolve renders the asset's body, dropping the placeholders it used.
+func (b BodyRenderer) resolve(a *Asset) {
+	a.Data.Body = b.render(a.Data.Body, a.Data.BodyPlaceholders)
+	a.Data.BodyPlaceholders = nil
+}
+
+func (b BodyRenderer) render(body string, placeholders map[string]BodyPlaceholder) string {
+	return placeholderPattern.ReplaceAllStringFunc(body, func(element string) string {
+		id := placeholderPattern.FindStringSubmatch(element)[1]
+		p, ok := placeholders[html.UnescapeString(id)]
+		if !ok {
+			return ""
+		}
+		return b.placeholder(p)
+	})
+}
+
+// placeholder builds the HTML for one placeholder. Types without enough
+// data to show, or that aren't known, render as nothing.
+func (b BodyRenderer) placeholder(p BodyPlaceholder) string {
+	switch p.Type {
+	case "image":
+		return b.image(p)
+
+	case "twitter":
+		if link := safeURL(p.text("url")); link != "" {
+			return fmt.Sprintf(`<blockquote class="twitter-tweet"><a href="%s">%s</a></blockquote>`, link, link)
+		}
+
+	case "linkExternal":
+		link := safeURL(p.text("url"))
+		return p.linkText(func(text string) string {
+			if link == "" {
+				return text
+			}
+			return fmt.Sprintf(`<a href="%s">%s</a>`, link, text)
+		})
+
+	case "linkArticle":
+		// Links to other articles only carry the article's ID, so keep
+		// the sentence they are part of.
+		return p.linkText(func(text string) string { return text })
+
+	case "quote":
+		if quote := p.text("quote"); quote != "" {
+			cite := ""
+			if byline := p.text("quoteByline"); byline != "" {
+				cite = "<cite>" + html.EscapeString(byline) + "</cite>"
+			}
+			return fmt.Sprintf(`<blockquote class="quote"><p>%s</p>%s</blockquote>`, html.EscapeString(quote), cite)
+		}
+
+	case "relatedStory":
+		// Related stories only carry the asset's ID, so leave a marker
+		// for clients to fill in, as images keep their data-image-id.
+		if id := p.text("id"); id != "" {
+			return fmt.Sprintf(`<aside class="related-story" data-asset-id="%s" data-asset-type="%s"></aside>`, html.EscapeString(id), html.EscapeString(p.text("type")))
+		}
+
+	case "iframe", "infogram":
+		if link := safeURL(p.text("url")); link != "" {
+			return fmt.Sprintf(`<iframe class="%s" src="%s"></iframe>`, p.Type, link)
+		}
+	}
+	return ""
+}
+
+func (b BodyRenderer) image(p BodyPlaceholder) string {
+	id, file := p.text("id"), p.text("fileName")
+	if id == "" && file == "" {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, `<figure class="image" data-image-id="%s">`, html.EscapeString(id))
+	if b.ImageBaseURL != "" && file != "" {
+		fmt.Fprintf(&out, `<img src="%s" alt="%s">`, html.EscapeString(b.ImageBaseURL+url.PathEscape(file)), html.EscapeString(p.text("altText")))
+	}
+
+	caption, credit := p.text("caption"), p.text("credit")
+	if caption != "" || credit != "" {
+		out.WriteString("<figcaption>" + html.EscapeString(caption))
+		if credit != "" {
+			fmt.Fprintf(&out, ` <span class="credit">%s</span>`, html.EscapeString(credit))
+		}
+		out.WriteString("</figcaption>")
+	}
+	out.WriteString("</figure>")
+	return out.String()
+}
+
+// text returns a string field of the placeholder's data.
+func (p BodyPlaceholder) text(field string) string {
+	s, _ := p.Data[field].(string)
+	return strings.TrimSpace(s)
+}
+
+// linkText escapes the text of a link and wraps it, keeping any spaces
+// around it outside the link.
+func (p BodyPlaceholder) linkText(wrap func(string) string) string {
+	raw, _ := p.Data["text"].(string)
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return raw
+	}
+
+	i := strings.Index(raw, text)
+	return raw[:i] + wrap(html.EscapeString(text)) + raw[i+len(text):]
+}
+
+// safeURL escapes a link for an attribute, refusing anything but http and
+// https. Links in placeholders are sometimes escaped already.
+func safeURL(link string) string {
+	u, err := url.Parse(html.UnescapeString(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return html.EscapeString(u.String())
+}
+
+// parseBodyFormat reads the bodyFormat parameter, reporting whether bodies
+// should be resolved.
+func parseBodyFormat(query url.Values) (bool, *APIError) {
+	switch strings.ToLower(query.Get("bodyFormat")) {
+	case "", bodyFormatHTML:
+		return false, nil
+	case bodyFormatResolved:
+		return true, nil
+	}
+	return false, invalidParameter("bodyFormat", fmt.Sprintf("bodyFormat must be '%s' or '%s'", bodyFormatHTML, bodyFormatResolved))
+}
+
+// assetFeed is a response whose assets can be changed in place.
+type assetFeed interface {
+	eachAsset(fn func(*Asset))
+}
+
+func (r SuburbRecord) eachAsset(fn func(*Asset)) {
+	for i := range r.Assets {
+		fn(&r.Assets[i])
+	}
+}
+
+func (f MergedFeed) eachAsset(fn func(*Asset)) {
+	for i := range f.Assets {
+		fn(&f.Assets[i].Asset)
+	}
+}
+
+func (f BoxFeed) eachAsset(fn func(*Asset)) {
+	for _, s := range f.Suburbs {
+		for i := range s.Assets {
+			fn(&s.Assets[i])
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"log"
+)
+
+// BoltStore is a Store backed by a single shared bbolt database, with the
+// spatial indexes kept in memory.
+type BoltStore struct {
+	db        *bolt.DB
+	locations GeoIndex
+	feeds     GeoIndex
+}
+
+// boltSchemaVersion changes whenever the way keys are built changes. A
+// database written with another version is emptied and reloaded from the
+// source files.
+const boltSchemaVersion = "3"
+
+// NewBoltStore creates any missing buckets and indexes what is already in
+// the database.
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucket)); meta == nil || string(meta.Get([]byte("schema"))) != boltSchemaVersion {
+			for _, name := range []string{locationsBucket, feedsBucket, metaBucket, postcodesBucket} {
+				if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+			}
+		}
+
+		for _, name := range []string{locationsBucket, feedsBucket, metaBucket, lookupsBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("failed to create bucket: %v", err)
+			}
+		}
+
+		if err := tx.Bucket([]byte(metaBucket)).Put([]byte("schema"), []byte(boltSchemaVersion)); err != nil {
+			return err
+		}
+		return reindexPostcodes(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{db: db}
+	if err := s.reindexLocations(); err != nil {
+		return nil, err
+	}
+	if err := s.reindexFeeds(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewReadOnlyBoltStore indexes a database opened read-only, as by the
+// coverage command, without creating or upgrading its buckets.
+func NewReadOnlyBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucket)); meta == nil || string(meta.Get([]byte("schema"))) != boltSchemaVersion {
+			return fmt.Errorf("database is not at schema version %s, start the server once to load it", boltSchemaVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{db: db}
+	if err := s.reindexLocations(); err != nil {
+		return nil, err
+	}
+	if err := s.reindexFeeds(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BoltStore) get(bucketName string, key string, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketName))
+		if bucket == nil {
+			return fmt.Errorf("failed to get '%s' bucket", bucketName)
+		}
+
+		b := bucket.Get([]byte(key))
+		if b == nil {
+			return &NotFoundError{key}
+		}
+
+		if err := json.Unmarshal(b, v); err != nil {
+			return fmt.Errorf("failed to unmarshal data for '%s'", key)
+		}
+
+		return nil
+	})
+}
+
+// errStopScan ends a scanPrefix early without reporting an error.
+var errStopScan = errors.New("stop scan")
+
+// scanPrefix calls fn for every key in the bucket that starts with prefix.
+func (s *BoltStore) scanPrefix(bucketName string, prefix string, fn func(key, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucketName)).Cursor()
+		p := []byte(prefix)
+
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetLocation(key string) (Location, error) {
+	var loc Location
+	err := s.get(locationsBucket, key, &loc)
+	return loc, err
+}
+
+func (s *BoltStore) FindLocations(name string, state string, postcode string) ([]Location, error) {
+	var locations []Location
+
+	err := s.scanPrefix(locationsBucket, namePrefix(name), func(key, value []byte) error {
+		var loc Location
+		if err := json.Unmarshal(value, &loc); err != nil {
+			return fmt.Errorf("failed to unmarshal data for '%s'", key)
+		}
+		if matches(loc.info(), state, postcode) {
+			locations = append(locations, loc)
+		}
+		return nil
+	})
+
+	return locations, err
+}
+
+func (s *BoltStore) GetFeed(key string) (SuburbRecord, error) {
+	var record SuburbRecord
+	err := s.get(feedsBucket, key, &record)
+	return record, err
+}
+
+func (s *BoltStore) FindFeeds(name string, state string, postcode string) ([]SuburbRecord, error) {
+	var records []SuburbRecord
+
+	err := s.scanPrefix(feedsBucket, namePrefix(name), func(key, value []byte) error {
+		var record SuburbRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return fmt.Errorf("failed to unmarshal data for '%s'", key)
+		}
+		if matches(record.SuburbInfo, state, postcode) {
+			records = append(records, record)
+		}
+		return nil
+	})
+
+	return records, err
+}
+
+func (s *BoltStore) SuburbsWithPrefix(prefix string, limit int) ([]Location, error) {
+	p := foldName(prefix)
+
+	locations, err := s.scanNames(locationsBucket, p, limit, func(value []byte) (Location, error) {
+		var loc Location
+		err := json.Unmarshal(value, &loc)
+		return loc, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := s.scanNames(feedsBucket, p, limit, func(value []byte) (Location, error) {
+		var info SuburbInfo
+		err := json.Unmarshal(value, &info)
+		return info.location(), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSuburbs(limit, locations, feeds), nil
+}
+
+// scanNames decodes the entries of a bucket whose names start with prefix,
+// up to limit names. It reads every entry of those names, so that merging
+// them with another bucket's before applying the limit loses none of the
+// first suburbs.
+func (s *BoltStore) scanNames(bucketName string, prefix string, limit int, decode func([]byte) (Location, error)) ([]Location, error) {
+	var found []Location
+	var last string
+	names := 0
+
+	err := s.scanPrefix(bucketName, prefix, func(key, value []byte) error {
+		name := string(key[:bytes.IndexByte(key, '|')+1])
+		if name != last {
+			if limit > 0 && names == limit {
+				return errStopScan
+			}
+			last = name
+			names++
+		}
+
+		loc, err := decode(value)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal data for '%s'", key)
+		}
+		found = append(found, loc)
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (s *BoltStore) SuburbNames() ([]string, error) {
+	locations := s.locations.all()
+	if locations == nil {
+		var err error
+		if locations, err = s.readLocations(); err != nil {
+			return nil, err
+		}
+	}
+
+	return locationNames(locations, s.feeds.all()), nil
+}
+
+func (s *BoltStore) FindPostcode(postcode string) ([]SuburbInfo, error) {
+	var suburbs []SuburbInfo
+
+	err := s.scanPrefix(postcodesBucket, postcode+"|", func(key, value []byte) error {
+		var info SuburbInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			return fmt.Errorf("failed to unmarshal data for '%s'", key)
+		}
+		suburbs = append(suburbs, info)
+		return nil
+	})
+
+	return suburbs, err
+}
+
+// NearestLocations answers from the spatial index, falling back to a
+// throwaway tree built from the bucket while no index is available.
+func (s *BoltStore) NearestLocations(lat, lon float64, k int, radius float64) ([]Neighbour, error) {
+	if found, ok := s.locations.search(lat, lon, k, radius); ok {
+		return found, nil
+	}
+
+	locations, err := s.readLocations()
+	if err != nil {
+		return nil, err
+	}
+	return newKDTree(locations).search(lat, lon, k, radius), nil
+}
+
+func (s *BoltStore) NearestFeeds(lat, lon float64, k int, radius float64) ([]Neighbour, error) {
+	if found, ok := s.feeds.search(lat, lon, k, radius); ok {
+		return found, nil
+	}
+
+	locations, err := s.readFeedLocations()
+	if err != nil {
+		return nil, err
+	}
+	return newKDTree(locations).search(lat, lon, k, radius), nil
+}
+
+func (s *BoltStore) Feeds() ([]SuburbRecord, error) {
+	var records []SuburbRecord
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(feedsBucket)).ForEach(func(key, value []byte) error {
+			var record SuburbRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("failed to unmarshal data for '%s'", key)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+func (s *BoltStore) FeedsInBox(box BBox) ([]Location, error) {
+	locations := s.feeds.all()
+	if locations == nil {
+		var err error
+		if locations, err = s.readFeedLocations(); err != nil {
+			return nil, err
+		}
+	}
+
+	return inBox(box, locations), nil
+}
+
+func (s *BoltStore) PutFeed(record SuburbRecord) error {
+	key := record.key()
+	enc, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode feed '%s': %v", key, err)
+	}
+
+	// The feed index only needs rebuilding when a suburb is added or moves,
+	// not when the sweep rewrites its assets.
+	moved := true
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(feedsBucket))
+
+		var old SuburbInfo
+		if v := bucket.Get([]byte(key)); v != nil && json.Unmarshal(v, &old) == nil {
+			moved = old != record.SuburbInfo
+		}
+
+		if err := bucket.Put([]byte(key), enc); err != nil {
+			return fmt.Errorf("failed to save to feed db '%s': %v", key, err)
+		}
+		return indexPostcode(tx, record.SuburbInfo)
+	})
+	if err != nil || !moved {
+		return err
+	}
+
+	return s.reindexFeeds()
+}
+
+// PutLocations writes every location in one transaction, skipping those
+// already stored as-is and deleting those no longer present, and then
+// rebuilds the location index.
+func (s *BoltStore) PutLocations(locations []Location) (LocationChanges, error) {
+	var changes LocationChanges
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(locationsBucket))
+		keep := make(map[string]bool, len(locations))
+
+		for _, loc := range locations {
+			key := loc.Key()
+			keep[key] = true
+
+			enc, err := json.Marshal(loc)
+			if err != nil {
+				return fmt.Errorf("failed to encode location '%s': %v", key, err)
+			}
+
+			prev := bucket.Get([]byte(key))
+			switch {
+			case prev == nil:
+				changes.Inserted++
+			case bytes.Equal(prev, enc):
+				continue
+			default:
+				changes.Updated++
+			}
+
+			if err := bucket.Put([]byte(key), enc); err != nil {
+				return fmt.Errorf("failed to insert '%s': %v", key, err)
+			}
+		}
+
+		var stale [][]byte
+		bucket.ForEach(func(key, value []byte) error {
+			if !keep[string(key)] {
+				stale = append(stale, append([]byte(nil), key...))
+			}
+			return nil
+		})
+
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete '%s': %v", key, err)
+			}
+			changes.Deleted++
+		}
+		return reindexPostcodes(tx)
+	})
+	if err != nil {
+		return LocationChanges{}, err
+	}
+
+	return changes, s.reindexLocations()
+}
+
+func (s *BoltStore) AddLookups(stats []LookupStat) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(lookupsBucket))
+
+		for _, stat := range stats {
+			key := []byte(stat.key())
+
+			var prev LookupStat
+			if value := bucket.Get(key); value != nil {
+				if err := json.Unmarshal(value, &prev); err != nil {
+					return fmt.Errorf("failed to unmarshal data for '%s'", key)
+				}
+			}
+			prev.add(stat)
+
+			enc, err := json.Marshal(prev)
+			if err != nil {
+				return fmt.Errorf("failed to encode lookups '%s': %v", key, err)
+			}
+			if err := bucket.Put(key, enc); err != nil {
+				return fmt.Errorf("failed to save to lookups db '%s': %v", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Lookups() ([]LookupStat, error) {
+	var stats []LookupStat
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(lookupsBucket)).ForEach(func(key, value []byte) error {
+			var stat LookupStat
+			if err := json.Unmarshal(value, &stat); err != nil {
+				return fmt.Errorf("failed to unmarshal data for '%s'", key)
+			}
+			stats = append(stats, stat)
+			return nil
+		})
+	})
+
+	return stats, err
+}
+
+func (s *BoltStore) GetMeta(key string) (string, error) {
+	var value string
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(metaBucket)).Get([]byte(key))
+		if b == nil {
+			return &NotFoundError{key}
+		}
+		value = string(b)
+		return nil
+	})
+
+	return value, err
+}
+
+func (s *BoltStore) PutMeta(key string, value string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(key), []byte(value))
+	})
+}
+
+func (s *BoltStore) readLocations() ([]Location, error) {
+	var locations []Location
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(locationsBucket)).ForEach(func(key, value []byte) error {
+			var loc Location
+			if err := json.Unmarshal(value, &loc); err == nil {
+				locations = append(locations, loc)
+			}
+			return nil
+		})
+	})
+
+	return locations, err
+}
+
+func (s *BoltStore) readFeedLocations() ([]Location, error) {
+	var locations []Location
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(feedsBucket)).ForEach(func(key, value []byte) error {
+			var record SuburbRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return nil
+			}
+			if loc, ok := feedLocation(record); ok {
+				locations = append(locations, loc)
+			}
+			return nil
+		})
+	})
+
+	return locations, err
+}
+
+func (s *BoltStore) reindexLocations() error {
+	locations, err := s.readLocations()
+	if err != nil {
+		return err
+	}
+
+	s.locations.swap(newKDTree(locations))
+	log.Printf("Indexed %d locations", len(locations))
+	return nil
+}
+
+func (s *BoltStore) reindexFeeds() error {
+	locations, err := s.readFeedLocations()
+	if err != nil {
+		return err
+	}
+
+	s.feeds.swap(newKDTree(locations))
+	return nil
+}
+
+// reindexPostcodes rebuilds the postcode index from the locations and feeds
+// within the transaction that changed them.
+func reindexPostcodes(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket([]byte(postcodesBucket)); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+
+	index, err := tx.CreateBucket([]byte(postcodesBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket: %v", err)
+	}
+
+	err = tx.Bucket([]byte(locationsBucket)).ForEach(func(key, value []byte) error {
+		var loc Location
+		if err := json.Unmarshal(value, &loc); err != nil {
+			return nil
+		}
+		return putPostcode(index, loc.info())
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(feedsBucket)).ForEach(func(key, value []byte) error {
+		var info SuburbInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			return nil
+		}
+		return putPostcode(index, info)
+	})
+}
+
+// indexPostcode adds or updates one suburb's entry in the postcode index.
+func indexPostcode(tx *bolt.Tx, info SuburbInfo) error {
+	index, err := tx.CreateBucketIfNotExists([]byte(postcodesBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket: %v", err)
+	}
+	return putPostcode(index, info)
+}
+
+func putPostcode(index *bolt.Bucket, info SuburbInfo) error {
+	if info.Postcode == "" {
+		return nil
+	}
+
+	enc, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return index.Put([]byte(postcodeKey(info)), enc)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// nameProperties, stateProperties and postcodeProperties are the feature
+// properties, compared case-insensitively, that boundaries take their suburb
+// from.
+var (
+	nameProperties     = []string{"suburb", "name", "locality"}
+	stateProperties    = []string{"state"}
+	postcodeProperties = []string{"postcode"}
+)
+
+// ring is a closed loop of [lon, lat] points.
+type ring [][2]float64
+
+// polygon is an outer ring followed by any holes cut out of it.
+type polygon []ring
+
+// Boundary is the area covered by one suburb.
+type Boundary struct {
+	SuburbInfo
+	polygons []polygon
+
+	minLat, minLon, maxLat, maxLon float64
+}
+
+// contains reports whether the point falls inside the boundary. Points on
+// an edge may go either way.
+func (b *Boundary) contains(lat, lon float64) bool {
+	if lat < b.minLat || lat > b.maxLat || lon < b.minLon || lon > b.maxLon {
+		return false
+	}
+
+	for _, p := range b.polygons {
+		if len(p) == 0 || !p[0].contains(lat, lon) {
+			continue
+		}
+
+		inHole := false
+		for _, hole := range p[1:] {
+			if hole.contains(lat, lon) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// center is the middle of the boundary's bounding box.
+func (b *Boundary) center() (float64, float64) {
+	return (b.minLat + b.maxLat) / 2, (b.minLon + b.maxLon) / 2
+}
+
+// contains casts a ray from the point and counts the edges it crosses.
+func (r ring) contains(lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		lon1, lat1 := r[i][0], r[i][1]
+		lon2, lat2 := r[j][0], r[j][1]
+
+		if (lat1 > lat) != (lat2 > lat) && lon < (lon2-lon1)*(lat-lat1)/(lat2-lat1)+lon1 {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Boundaries holds the suburb boundaries loaded from a GeoJSON file. A reload
+// only replaces them once the new set is ready.
+type Boundaries struct {
+	mu         sync.RWMutex
+	boundaries []*Boundary
+}
+
+// find returns the first boundary containing the point.
+func (b *Boundaries) find(lat, lon float64) (*Boundary, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, boundary := range b.boundaries {
+		if boundary.contains(lat, lon) {
+			return boundary, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Boundaries) all() []*Boundary {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.boundaries
+}
+
+func (b *Boundaries) swap(boundaries []*Boundary) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.boundaries = boundaries
+}
+
+type geoJSONFeature struct {
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+type geoJSONFeatureCollection struct {
+	Features []geoJSONFeature `json:"features"`
+}
+
+// property returns the first of keys the feature has, as a string.
+func (f geoJSONFeature) property(keys []string) string {
+	for k, v := range f.Properties {
+		for _, key := range keys {
+			if !strings.EqualFold(k, key) {
+				continue
+			}
+			switch v := v.(type) {
+			case string:
+				return strings.TrimSpace(v)
+			case float64:
+				return fmt.Sprintf("%.0f", v)
+			}
+		}
+	}
+	return ""
+}
+
+// readPolygons decodes a Polygon or MultiPolygon geometry.
+func readPolygons(kind string, coordinates json.RawMessage) ([]polygon, error) {
+	var positions [][][][]float64
+
+	switch kind {
+	case "Polygon":
+		var single [][][]float64
+		if err := json.Unmarshal(coordinates, &single); err != nil {
+			return nil, err
+		}
+		positions = [][][][]float64{single}
+	case "MultiPolygon":
+		if err := json.Unmarshal(coordinates, &positions); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry '%s'", kind)
+	}
+
+	polygons := make([]polygon, len(positions))
+	for i, rings := range positions {
+		polygons[i] = make(polygon, len(rings))
+		for j, points := range rings {
+			if len(points) < 3 {
+				return nil, fmt.Errorf("ring with %d points", len(points))
+			}
+			polygons[i][j] = make(ring, len(points))
+			for k, pt := range points {
+				if len(pt) < 2 {
+					return nil, fmt.Errorf("position with %d values", len(pt))
+				}
+				polygons[i][j][k] = [2]float64{pt[0], pt[1]}
+			}
+		}
+	}
+	return polygons, nil
+}
+
+func newBoundary(info SuburbInfo, polygons []polygon) *Boundary {
+	b := &Boundary{SuburbInfo: info, polygons: polygons}
+	first := true
+	for _, p := range polygons {
+		if len(p) == 0 {
+			continue
+		}
+		for _, pt := range p[0] {
+			lon, lat := pt[0], pt[1]
+			if first || lat < b.minLat {
+				b.minLat = lat
+			}
+			if first || lat > b.maxLat {
+				b.maxLat = lat
+			}
+			if first || lon < b.minLon {
+				b.minLon = lon
+			}
+			if first || lon > b.maxLon {
+				b.maxLon = lon
+			}
+			first = false
+		}
+	}
+	return b
+}
+
+// parseBoundaries reads suburb boundaries from a GeoJSON feature collection.
+// Features without a suburb name or a polygon are rejected.
+func parseBoundaries(b []byte) ([]*Boundary, []RejectedRow, error) {
+	var collection geoJSONFeatureCollection
+	if err := json.Unmarshal(b, &collection); err != nil {
+		return nil, nil, err
+	}
+
+	var boundaries []*Boundary
+	var rejected []RejectedRow
+
+	for i, f := range collection.Features {
+		name, state := splitState(f.property(nameProperties))
+		if name == "" {
+			rejected = append(rejected, RejectedRow{Line: i, Reason: "no suburb name"})
+			continue
+		}
+		if s := f.property(stateProperties); s != "" {
+			state = strings.ToUpper(s)
+		}
+
+		if f.Geometry == nil {
+			rejected = append(rejected, RejectedRow{Line: i, Reason: fmt.Sprintf("no geometry for '%s'", name)})
+			continue
+		}
+
+		polygons, err := readPolygons(f.Geometry.Type, f.Geometry.Coordinates)
+		if err != nil {
+			rejected = append(rejected, RejectedRow{Line: i, Reason: fmt.Sprintf("bad geometry for '%s': %v", name, err)})
+			continue
+		}
+
+		info := SuburbInfo{Name: name, State: state, Postcode: f.property(postcodeProperties)}
+		boundaries = append(boundaries, newBoundary(info, polygons))
+	}
+
+	return boundaries, rejected, nil
+}
+
+// loadBoundaries replaces the boundaries with those in the GeoJSON file at
+// path. A missing file leaves lookups on nearest centroids.
+func loadBoundaries(path string, boundaries *Boundaries) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No %s, resolving coordinates to the nearest suburb", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded, rejected, err := parseBoundaries(b)
+	if err != nil {
+		return fmt.Errorf("failed to decode '%s': %v", path, err)
+	}
+
+	for _, r := range rejected {
+		log.Printf("Rejected %s feature %d: %s", path, r.Line, r.Reason)
+	}
+	log.Printf("Loaded %d boundaries from %s, %d rejected", len(loaded), path, len(rejected))
+
+	boundaries.swap(loaded)
+	return nil
+}
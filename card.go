@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// thumbnailCrops are the featured image crops a card prefers, best first.
+var thumbnailCrops = []string{"landscape3x2", "landscape16x9", "square1x1", "portrait2x3"}
+
+// cardFields are the fields of AssetCard that fields= can pick from.
+var cardFields = []string{"id", "type", "headline", "intro", "thumbnail", "url", "published", "sourceSuburb", "distance", "fromNeighbour"}
+
+// CardImage is the featured image shown on a card and the crop it is.
+type CardImage struct {
+	Crop string `json:"crop"`
+	AssetImageData
+}
+
+// AssetCard is the compact form of an asset for lists and mobile clients.
+type AssetCard struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Headline  string     `json:"headline"`
+	Intro     string     `json:"intro,omitempty"`
+	Thumbnail *CardImage `json:"thumbnail,omitempty"`
+	URL       *AssetURL  `json:"url,omitempty"`
+	Published string     `json:"published,omitempty"`
+	Source    string     `json:"sourceSuburb,omitempty"`
+	Distance  *float64   `json:"distance,omitempty"`
+	Neighbour bool       `json:"fromNeighbour,omitempty"`
+}
+
+// thumbnail picks the featured image crop a card should show.
+func thumbnail(images map[string]AssetImage) *CardImage {
+	for _, crop := range thumbnailCrops {
+		if img, ok := images[crop]; ok {
+			return &CardImage{crop, img.Data}
+		}
+	}
+
+	crops := make([]string, 0, len(images))
+	for crop := range images {
+		crops = append(crops, crop)
+	}
+	if len(crops) == 0 {
+		return nil
+	}
+	sort.Strings(crops)
+	return &CardImage{crops[0], images[crops[0]].Data}
+}
+
+// newCard takes an asset's medium headline, intro, best featured image and
+// canonical URL, falling back to the full headline and the about text.
+func newCard(a Asset) AssetCard {
+	c := AssetCard{
+		ID:        a.ID,
+		Type:      a.AssetType,
+		Headline:  a.Data.Headlines.Medium,
+		Intro:     a.Data.Intro,
+		Thumbnail: thumbnail(a.Images),
+		URL:       a.URLs.Canonical,
+	}
+	if c.Headline == "" {
+		c.Headline = a.Data.Headlines.Headline
+	}
+	if c.Intro == "" {
+		c.Intro = a.Data.About
+	}
+	if t := publishedAt(a); !t.IsZero() {
+		c.Published = t.Format(time.RFC3339)
+	}
+	return c
+}
+
+func feedCard(a FeedAsset) AssetCard {
+	c := newCard(a.Asset)
+	c.Source, c.Distance, c.Neighbour = a.Source, a.Distance, a.Neighbour
+	return c
+}
+
+// View is how much of each asset a request asks for. The full view is the
+// asset as stored; the card view is an AssetCard, cut down to Fields when
+// they are given.
+type View struct {
+	Card   bool
+	Fields []string
+}
+
+// project returns the card with only the fields asked for, and always its
+// ID.
+func (v View) project(c AssetCard) interface{} {
+	if len(v.Fields) == 0 {
+		return c
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return c
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return c
+	}
+
+	projected := map[string]json.RawMessage{"id": all["id"]}
+	for _, f := range v.Fields {
+		if value, ok := all[f]; ok {
+			projected[f] = value
+		}
+	}
+	return projected
+}
+
+func (v View) assets(assets []Asset) []interface{} {
+	cards := make([]interface{}, len(assets))
+	for i, a := range assets {
+		cards[i] = v.project(newCard(a))
+	}
+	return cards
+}
+
+func (v View) feedAssets(assets []FeedAsset) []interface{} {
+	cards := make([]interface{}, len(assets))
+	for i, a := range assets {
+		cards[i] = v.project(feedCard(a))
+	}
+	return cards
+}
+
+// parseView reads the view and fields parameters. Fields imply the card
+// view.
+func parseView(query url.Values) (View, *APIError) {
+	var v View
+	switch strings.ToLower(query.Get("view")) {
+	case "", "full":
+	case "card":
+		v.Card = true
+	default:
+		return v, invalidParameter("view", "view must be 'card' or 'full'")
+	}
+
+	v.Fields = parseList(query, "fields")
+	if len(v.Fields) == 0 {
+		return v, nil
+	}
+	if query.Get("view") != "" && !v.Card {
+		return v, invalidParameter("fields", "fields can only be used with view=card")
+	}
+	for _, f := range v.Fields {
+		found := false
+		for _, name := range cardFields {
+			if f == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return v, invalidParameter("fields", fmt.Sprintf("unknown field '%s', expected any of %s", f, strings.Join(cardFields, ", ")))
+		}
+	}
+	v.Card = true
+	return v, nil
+}
+
+// cardFeed is a response whose assets can be shown as cards.
+type cardFeed interface {
+	cards(v View) interface{}
+}
+
+// SuburbCards is a single suburb's feed in the card view.
+type SuburbCards struct {
+	SuburbInfo
+	Distance   *float64      `json:"distance,omitempty"`
+	Assets     []interface{} `json:"assets"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+	Source     string        `json:"source,omitempty"`
+}
+
+// MergedCards is a merged feed in the card view.
+type MergedCards struct {
+	Suburbs    []MergedSuburb `json:"suburbs"`
+	Assets     []interface{}  `json:"assets"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	Source     string         `json:"source,omitempty"`
+}
+
+// BoxSuburbCards is a suburb of a BoxFeed in the card view.
+type BoxSuburbCards struct {
+	SuburbInfo
+	Assets      []interface{} `json:"assets"`
+	TotalAssets int           `json:"totalAssets"`
+}
+
+func (f SuburbFeed) cards(v View) interface{} {
+	return SuburbCards{f.SuburbInfo, nil, v.assets(f.Assets), f.NextCursor, f.Source}
+}
+
+func (f FeedRecord) cards(v View) interface{} {
+	return SuburbCards{f.SuburbInfo, &f.Distance, v.assets(f.Assets), f.NextCursor, f.Source}
+}
+
+func (f MergedFeed) cards(v View) interface{} {
+	return MergedCards{f.Suburbs, v.feedAssets(f.Assets), f.NextCursor, f.Source}
+}
+
+func (f FallbackFeed) cards(v View) interface{} {
+	return struct {
+		Suburb   SuburbInfo `json:"requestedSuburb"`
+		Fallback string     `json:"fallback"`
+		MergedCards
+	}{f.Suburb, f.Fallback, f.MergedFeed.cards(v).(MergedCards)}
+}
+
+func (f RollupFeed) cards(v View) interface{} {
+	return struct {
+		Name string `json:"name"`
+		MergedCards
+		TotalAssets int `json:"totalAssets"`
+	}{f.Name, f.MergedFeed.cards(v).(MergedCards), f.TotalAssets}
+}
+
+func (f BoxFeed) cards(v View) interface{} {
+	suburbs := make([]BoxSuburbCards, len(f.Suburbs))
+	for i, s := range f.Suburbs {
+		suburbs[i] = BoxSuburbCards{s.SuburbInfo, v.assets(s.Assets), s.TotalAssets}
+	}
+	return struct {
+		Suburbs   []BoxSuburbCards `json:"suburbs"`
+		Truncated bool             `json:"truncated"`
+	}{suburbs, f.Truncated}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// cellsPerTile divides each 256 pixel map tile into cells 64 pixels
+	// across, about the size of a marker.
+	cellsPerTile = 4
+
+	// maxMercatorLat is where the web map projection stops.
+	maxMercatorLat = 85.05112878
+
+	topHeadlines = 3
+)
+
+// Headline is a short reference to an asset for display on a marker.
+type Headline struct {
+	ID        string `json:"id"`
+	Headline  string `json:"headline"`
+	Suburb    string `json:"suburb"`
+	Published string `json:"published,omitempty"`
+}
+
+// Cluster is a group of suburbs with feeds that share a grid cell at some
+// zoom level. Its ID names the cell, so it stays the same between requests
+// whatever the viewport.
+type Cluster struct {
+	ID          string      `json:"id"`
+	Lat         float64     `json:"lat"`
+	Lon         float64     `json:"lon"`
+	Suburbs     int         `json:"suburbs"`
+	TotalAssets int         `json:"totalAssets"`
+	Headlines   []Headline  `json:"headlines"`
+	Suburb      *SuburbInfo `json:"suburb,omitempty"`
+}
+
+// ClusterFeed is the response of /newsfeed/clusters.
+type ClusterFeed struct {
+	Zoom     int       `json:"zoom"`
+	Clusters []Cluster `json:"clusters"`
+}
+
+// gridCell is a cell of the grid laid over the web map projection at a zoom
+// level, numbered from the top left.
+type gridCell struct {
+	zoom, x, y int
+}
+
+func gridSize(zoom int) float64 {
+	return math.Exp2(float64(zoom)) * cellsPerTile
+}
+
+func cellFor(lat, lon float64, zoom int) gridCell {
+	lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+	n := gridSize(zoom)
+
+	la := lat * math.Pi / 180
+	x := (lon + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(la)+1/math.Cos(la))/math.Pi) / 2 * n
+
+	last := int(n) - 1
+	return gridCell{zoom, clampInt(int(x), 0, last), clampInt(int(y), 0, last)}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// corner returns the latitude and longitude of the cell's top left corner.
+func (c gridCell) corner() (float64, float64) {
+	n := gridSize(c.zoom)
+	lon := float64(c.x)/n*360 - 180
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*float64(c.y)/n))) * 180 / math.Pi
+	return lat, lon
+}
+
+func (c gridCell) String() string {
+	return fmt.Sprintf("%d/%d/%d", c.zoom, c.x, c.y)
+}
+
+// cellBox widens a box to the edges of the cells it touches, so a cell is
+// either wholly in a query or not at all.
+func cellBox(box BBox, zoom int) BBox {
+	topLeft := cellFor(box.MaxLat, box.MinLon, zoom)
+	bottomRight := cellFor(box.MinLat, box.MaxLon, zoom)
+
+	maxLat, minLon := topLeft.corner()
+	minLat, maxLon := gridCell{zoom, bottomRight.x + 1, bottomRight.y + 1}.corner()
+	return BBox{minLat, minLon, maxLat, maxLon}
+}
+
+// clusterHandler serves /newsfeed/clusters, the suburbs with feeds in a
+// viewport grouped by grid cell at the map's zoom level.
+func (s *server) clusterHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	box, apiErr := parseBBox(query)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	zoom, zoomed, apiErr := parseZoom(query)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if !zoomed {
+		writeError(w, missingParameter("zoom", fmt.Sprintf("zoom is required, from 0 to %d", maxZoom)))
+		return
+	}
+
+	filter, apiErr := parseAssetFilter(query, s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	locations, err := s.store.FeedsInBox(cellBox(box, zoom))
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	cells := make(map[gridCell][]SuburbRecord)
+	for _, loc := range locations {
+		record, err := s.store.GetFeed(loc.Key())
+		if err != nil {
+			writeError(w, lookupError(err))
+			return
+		}
+
+		record.Assets = filter.apply(record.Assets)
+		cell := cellFor(record.Lat, record.Lon, zoom)
+		cells[cell] = append(cells[cell], record)
+	}
+
+	feed := ClusterFeed{Zoom: zoom, Clusters: []Cluster{}}
+	for cell, records := range cells {
+		feed.Clusters = append(feed.Clusters, newCluster(cell, records))
+	}
+
+	sort.Slice(feed.Clusters, func(i, j int) bool {
+		return feed.Clusters[i].ID < feed.Clusters[j].ID
+	})
+
+	s.writeFeed(w, r, feed)
+}
+
+func newCluster(cell gridCell, records []SuburbRecord) Cluster {
+	c := Cluster{ID: cell.String(), Suburbs: len(records), Headlines: []Headline{}}
+
+	var assets []FeedAsset
+	for _, r := range records {
+		c.Lat += r.Lat / float64(len(records))
+		c.Lon += r.Lon / float64(len(records))
+		c.TotalAssets += len(r.Assets)
+
+		for _, a := range r.Assets {
+			assets = append(assets, FeedAsset{Asset: a, Source: r.Name, suburbKey: r.key()})
+		}
+	}
+
+	if len(records) == 1 {
+		c.Suburb = &records[0].SuburbInfo
+	}
+
+	sort.SliceStable(assets, func(i, j int) bool {
+		return publishedAt(assets[i].Asset).After(publishedAt(assets[j].Asset))
+	})
+
+	seen := make(map[string]bool)
+	for _, a := range assets {
+		if len(c.Headlines) == topHeadlines {
+			break
+		}
+		if seen[a.ID] {
+			continue
+		}
+		seen[a.ID] = true
+
+		h := Headline{ID: a.ID, Headline: a.Data.Headlines.Headline, Suburb: a.Source}
+		if t := publishedAt(a.Asset); !t.IsZero() {
+			h.Published = t.Format(time.RFC3339)
+		}
+		c.Headlines = append(c.Headlines, h)
+	}
+
+	return c
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+const maxGeohashLength = 12
+
+// decodeGeohash returns the center of the cell a geohash names.
+func decodeGeohash(hash string) (float64, float64, error) {
+	if hash == "" || len(hash) > maxGeohashLength {
+		return 0, 0, fmt.Errorf("geohash must be 1 to %d characters, got %d", maxGeohashLength, len(hash))
+	}
+
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	even := true
+
+	for i, c := range strings.ToLower(hash) {
+		v := strings.IndexRune(geohashAlphabet, c)
+		if v < 0 {
+			return 0, 0, fmt.Errorf("geohash has invalid character '%c' at position %d", c, i+1)
+		}
+
+		for bit := 4; bit >= 0; bit-- {
+			on := v&(1<<uint(bit)) != 0
+			if even {
+				mid := (minLon + maxLon) / 2
+				if on {
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if on {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+
+	return (minLat + maxLat) / 2, (minLon + maxLon) / 2, nil
+}
+
+const (
+	plusCodeAlphabet  = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator = 8
+	plusCodePairs     = 10
+)
+
+// decodePlusCode returns the center of the area a full Open Location Code
+// names, such as "4RRH46J4+H5". Short codes like "46J4+H5" need a nearby
+// locality to resolve and are rejected.
+func decodePlusCode(code string) (float64, float64, error) {
+	code = strings.ToUpper(code)
+
+	sep := strings.IndexRune(code, '+')
+	switch {
+	case sep < 0:
+		return 0, 0, fmt.Errorf("plus code must contain '+'")
+	case strings.Count(code, "+") > 1:
+		return 0, 0, fmt.Errorf("plus code has a second '+' at position %d", strings.LastIndex(code, "+")+1)
+	case sep < plusCodeSeparator:
+		return 0, 0, fmt.Errorf("plus code '%s' is a short code, send the full code with %d characters before '+'", code, plusCodeSeparator)
+	case sep > plusCodeSeparator:
+		return 0, 0, fmt.Errorf("plus code has '+' at position %d, expected %d", sep+1, plusCodeSeparator+1)
+	case len(code)-sep-1 == 1:
+		return 0, 0, fmt.Errorf("plus code must have at least 2 characters after '+'")
+	}
+
+	digits := code[:sep] + code[sep+1:]
+
+	// Codes for larger areas are padded with zeros up to the '+'.
+	padding := strings.IndexRune(digits, '0')
+	if padding >= 0 {
+		switch {
+		case padding == 0 || padding%2 != 0:
+			return 0, 0, fmt.Errorf("plus code has padding at position %d, expected an even number of digits first", padding+1)
+		case strings.TrimRight(code[:sep], "0") != code[:padding] || len(code) > sep+1:
+			return 0, 0, fmt.Errorf("plus code padding must run up to a trailing '+'")
+		}
+		digits = digits[:padding]
+	}
+
+	values := make([]int, len(digits))
+	for i, c := range digits {
+		values[i] = strings.IndexRune(plusCodeAlphabet, c)
+		if values[i] < 0 {
+			pos := i + 1
+			if i >= sep {
+				pos++
+			}
+			return 0, 0, fmt.Errorf("plus code has invalid character '%c' at position %d", c, pos)
+		}
+	}
+
+	if values[0] > 8 {
+		return 0, 0, fmt.Errorf("plus code latitude digit '%c' is out of range", digits[0])
+	}
+	if values[1] > 17 {
+		return 0, 0, fmt.Errorf("plus code longitude digit '%c' is out of range", digits[1])
+	}
+
+	lat, lon := -90.0, -180.0
+	latRes, lonRes := 400.0, 400.0
+
+	for i := 0; i < len(values) && i < plusCodePairs; i += 2 {
+		latRes, lonRes = latRes/20, lonRes/20
+		lat += float64(values[i]) * latRes
+		lon += float64(values[i+1]) * lonRes
+	}
+
+	// Digits past the pairs each split the area into a 5 by 4 grid.
+	for i := plusCodePairs; i < len(values); i++ {
+		latRes, lonRes = latRes/5, lonRes/4
+		lat += float64(values[i]/4) * latRes
+		lon += float64(values[i]%4) * lonRes
+	}
+
+	return lat + latRes/2, lon + lonRes/2, nil
+}
+
+// angle is one half of a degrees-minutes-seconds pair as it was written.
+type angle struct {
+	parts      []float64
+	hemisphere rune
+	prefixed   bool
+	fraction   bool
+	negative   bool
+}
+
+func (a *angle) empty() bool {
+	return len(a.parts) == 0
+}
+
+func (a *angle) degrees() (float64, error) {
+	if len(a.parts) > 1 && a.parts[1] >= 60 {
+		return 0, fmt.Errorf("minutes must be less than 60, got %v", a.parts[1])
+	}
+	if len(a.parts) > 2 && a.parts[2] >= 60 {
+		return 0, fmt.Errorf("seconds must be less than 60, got %v", a.parts[2])
+	}
+
+	deg := 0.0
+	for i, p := range a.parts {
+		deg += p / []float64{1, 60, 3600}[i]
+	}
+
+	if a.negative {
+		if a.hemisphere != 0 {
+			return 0, fmt.Errorf("'%c' can't be used with a negative angle", a.hemisphere)
+		}
+		deg = -deg
+	}
+	if a.hemisphere == 'S' || a.hemisphere == 'W' {
+		deg = -deg
+	}
+	return deg, nil
+}
+
+// dmsUnits maps the symbols for degrees, minutes and seconds onto the index
+// of the part they end.
+var dmsUnits = map[rune]int{
+	'°': 0, 'º': 0, 'd': 0, 'D': 0,
+	'\'': 1, '′': 1, '’': 1,
+	'"': 2, '″': 2, '”': 2,
+}
+
+// parseDMS reads a pair of angles written in degrees, minutes and seconds,
+// such as 33°47'49"S 151°17'17"E, in either order when hemispheres are
+// given. Minutes and seconds are optional and the last part given may have
+// a fraction, so "33.797S, 151.288E" also works.
+func parseDMS(s string) (float64, float64, error) {
+	runes := []rune(s)
+	var angles []*angle
+	cur := &angle{}
+
+	closeAngle := func() {
+		if !cur.empty() {
+			angles = append(angles, cur)
+		}
+		cur = &angle{}
+	}
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == ',' || c == ';':
+			if cur.empty() && (len(angles) == 0 || cur.hemisphere != 0) {
+				return 0, 0, fmt.Errorf("unexpected '%c' at position %d", c, pos)
+			}
+			closeAngle()
+			i++
+
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			text := string(runes[i:j])
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid number '%s' at position %d", text, pos)
+			}
+
+			// A negative number, or one after a fraction, must start the
+			// next angle.
+			if !cur.empty() && (v < 0 || cur.fraction) {
+				closeAngle()
+			}
+			if cur.empty() && v < 0 {
+				cur.negative = true
+				v = -v
+			} else if v < 0 {
+				return 0, 0, fmt.Errorf("unexpected '-' at position %d", pos)
+			}
+
+			// A unit after the number says which part it is.
+			k := j
+			for k < len(runes) && unicode.IsSpace(runes[k]) {
+				k++
+			}
+			unit, hasUnit := 0, false
+			if k < len(runes) {
+				unit, hasUnit = dmsUnits[runes[k]]
+			}
+			if hasUnit && unit == 0 && !cur.empty() {
+				closeAngle()
+			}
+
+			if len(cur.parts) == 3 {
+				return 0, 0, fmt.Errorf("too many numbers at position %d", pos)
+			}
+			if hasUnit {
+				if unit != len(cur.parts) {
+					return 0, 0, fmt.Errorf("unexpected '%c' at position %d, expected %s", runes[k], k+1, []string{"degrees", "minutes", "seconds"}[len(cur.parts)])
+				}
+				j = k + 1
+			}
+			cur.parts = append(cur.parts, v)
+			cur.fraction = strings.ContainsRune(text, '.')
+			i = j
+
+		case strings.ContainsRune("NSEWnsew", c):
+			h := unicode.ToUpper(c)
+			switch {
+			case cur.empty() && cur.hemisphere == 0:
+				cur.hemisphere, cur.prefixed = h, true
+			case !cur.empty() && cur.hemisphere == 0:
+				cur.hemisphere = h
+				closeAngle()
+			case !cur.empty() && cur.prefixed:
+				closeAngle()
+				cur.hemisphere, cur.prefixed = h, true
+			default:
+				return 0, 0, fmt.Errorf("unexpected '%c' at position %d", c, pos)
+			}
+			i++
+
+		default:
+			return 0, 0, fmt.Errorf("unexpected '%c' at position %d", c, pos)
+		}
+	}
+
+	if cur.hemisphere != 0 && cur.empty() {
+		return 0, 0, fmt.Errorf("'%c' at the end has no angle", cur.hemisphere)
+	}
+	closeAngle()
+
+	if len(angles) != 2 {
+		return 0, 0, fmt.Errorf("expected a latitude and a longitude, got %d angles", len(angles))
+	}
+
+	first, second := angles[0], angles[1]
+	if isLongitude(first.hemisphere) || isLatitude(second.hemisphere) {
+		first, second = second, first
+	}
+	if isLongitude(first.hemisphere) || isLatitude(second.hemisphere) {
+		return 0, 0, fmt.Errorf("both angles are %s", map[bool]string{true: "longitudes", false: "latitudes"}[isLongitude(first.hemisphere)])
+	}
+
+	lat, err := first.degrees()
+	if err != nil {
+		return 0, 0, fmt.Errorf("latitude: %v", err)
+	}
+	lon, err := second.degrees()
+	if err != nil {
+		return 0, 0, fmt.Errorf("longitude: %v", err)
+	}
+
+	if lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("latitude must be between -90 and 90, got %v", lat)
+	}
+	if lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("longitude must be between -180 and 180, got %v", lon)
+	}
+	return lat, lon, nil
+}
+
+func isLatitude(h rune) bool {
+	return h == 'N' || h == 'S'
+}
+
+func isLongitude(h rune) bool {
+	return h == 'E' || h == 'W'
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// coordTest is a string a decoder should turn into a point, or fail on with
+// exactly the error given.
+type coordTest struct {
+	in       string
+	lat, lon float64
+	err      string
+}
+
+func checkCoords(t *testing.T, name string, decode func(string) (float64, float64, error), tests []coordTest) {
+	for _, test := range tests {
+		lat, lon, err := decode(test.in)
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s(%q) error = %v, want %q", name, test.in, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s(%q) failed: %v", name, test.in, err)
+		case math.Abs(lat-test.lat) > 1e-9 || math.Abs(lon-test.lon) > 1e-9:
+			t.Errorf("%s(%q) = %v, %v, want %v, %v", name, test.in, lat, lon, test.lat, test.lon)
+		}
+	}
+}
+
+func TestDecodeGeohash(t *testing.T) {
+	checkCoords(t, "decodeGeohash", decodeGeohash, []coordTest{
+		{in: "r3gxgy", lat: -33.75823974609375, lon: 151.3421630859375},
+		{in: "R3GXGY", lat: -33.75823974609375, lon: 151.3421630859375},
+		{in: "r", lat: -22.5, lon: 157.5},
+		{in: "r3gx2f9tt5", lat: -33.867140114307404, lon: 151.20711386203766},
+
+		{in: "", err: "geohash must be 1 to 12 characters, got 0"},
+		{in: "r3gx2f9tt5r3g", err: "geohash must be 1 to 12 characters, got 13"},
+		{in: "r3gaxg", err: "geohash has invalid character 'a' at position 4"},
+		{in: "r3gx-g", err: "geohash has invalid character '-' at position 5"},
+	})
+}
+
+func TestDecodePlusCode(t *testing.T) {
+	checkCoords(t, "decodePlusCode", decodePlusCode, []coordTest{
+		{in: "4RRH6775+V5", lat: -33.7853125, lon: 151.2579375},
+		{in: "4rrh6775+v5", lat: -33.7853125, lon: 151.2579375},
+		{in: "4RRH6775+V5X", lat: -33.7852625, lon: 151.257984375},
+		{in: "8FVC9G8F+6W", lat: 47.3655625, lon: 8.5248125},
+		// Padded codes name a whole cell.
+		{in: "4RRH0000+", lat: -33.5, lon: 151.5},
+		{in: "4R000000+", lat: -40, lon: 150},
+
+		{in: "4RRH6775V5", err: "plus code must contain '+'"},
+		{in: "4RRH+6775+V5", err: "plus code has a second '+' at position 10"},
+		{in: "6775+V5", err: "plus code '6775+V5' is a short code, send the full code with 8 characters before '+'"},
+		{in: "4RRH67752+V5", err: "plus code has '+' at position 10, expected 9"},
+		{in: "4RRH6775+V", err: "plus code must have at least 2 characters after '+'"},
+		{in: "4RR00000+", err: "plus code has padding at position 4, expected an even number of digits first"},
+		{in: "00000000+", err: "plus code has padding at position 1, expected an even number of digits first"},
+		{in: "4RRH0000+V5", err: "plus code padding must run up to a trailing '+'"},
+		{in: "4RRH00H0+", err: "plus code padding must run up to a trailing '+'"},
+		{in: "4RRI6775+V5", err: "plus code has invalid character 'I' at position 4"},
+		{in: "4RRH6775+A5", err: "plus code has invalid character 'A' at position 10"},
+		{in: "FRRH6775+V5", err: "plus code latitude digit 'F' is out of range"},
+		{in: "4WRH6775+V5", err: "plus code longitude digit 'W' is out of range"},
+	})
+}
+
+func TestParseDMS(t *testing.T) {
+	const manlyLat, manlyLon = -(33 + 47.0/60 + 49.0/3600), 151 + 17.0/60 + 17.0/3600
+
+	checkCoords(t, "parseDMS", parseDMS, []coordTest{
+		{in: `33°47'49"S 151°17'17"E`, lat: manlyLat, lon: manlyLon},
+		{in: `151°17'17"E, 33°47'49"S`, lat: manlyLat, lon: manlyLon},
+		{in: `33°47′49″S 151°17′17″E`, lat: manlyLat, lon: manlyLon},
+		{in: `33d 47' 49" s; 151d 17' 17" e`, lat: manlyLat, lon: manlyLon},
+		{in: "S33 47 49 E151 17 17", lat: manlyLat, lon: manlyLon},
+		{in: "33.797S, 151.288E", lat: -33.797, lon: 151.288},
+		{in: "33°47.5'S 151°17.25'E", lat: -(33 + 47.5/60), lon: 151 + 17.25/60},
+		{in: "-33.797 151.288", lat: -33.797, lon: 151.288},
+		{in: "-33.797, -151.288", lat: -33.797, lon: -151.288},
+
+		{in: `33°47'49"S`, err: "expected a latitude and a longitude, got 1 angles"},
+		{in: "33S 151E 12N", err: "expected a latitude and a longitude, got 3 angles"},
+		{in: "33°61'S 151°E", err: "latitude: minutes must be less than 60, got 61"},
+		{in: `33°S 151°17'60"E`, err: "longitude: seconds must be less than 60, got 60"},
+		{in: "33S 151S", err: "both angles are latitudes"},
+		{in: "151E 33W", err: "both angles are longitudes"},
+		{in: "-33S 151E", err: "latitude: 'S' can't be used with a negative angle"},
+		{in: "33x 151E", err: "unexpected 'x' at position 3"},
+		{in: "33'S 151E", err: "unexpected ''' at position 3, expected degrees"},
+		{in: "33° 47\" S 151E", err: "unexpected '\"' at position 7, expected minutes"},
+		{in: "33 47 49 12S 151E", err: "too many numbers at position 10"},
+		{in: ", 33S 151E", err: "unexpected ',' at position 1"},
+		{in: "33S 151E N", err: "'N' at the end has no angle"},
+		{in: "33.4.5S 151E", err: "invalid number '33.4.5' at position 1"},
+		{in: "95S 151E", err: "latitude must be between -90 and 90, got -95"},
+		{in: "33S 181E", err: "longitude must be between -180 and 180, got 181"},
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// gapDistance is how far, in meters, a suburb must be from the nearest
+	// feed for its lookups to count as a gap in coverage.
+	gapDistance = 10000
+
+	defaultCoverageGaps = 20
+	maxCoverageGaps     = 500
+)
+
+// FeedCoverage describes one suburb's feed, counting only the assets readers
+// can see.
+type FeedCoverage struct {
+	SuburbInfo
+	Assets          int        `json:"assets"`
+	NewestPublished *time.Time `json:"newestPublished,omitempty"`
+}
+
+// CoverageGap is a suburb people looked up that has no feed nearby.
+type CoverageGap struct {
+	SuburbInfo
+	Lookups             int      `json:"lookups"`
+	Misses              int      `json:"misses"`
+	NearestFeed         string   `json:"nearestFeed,omitempty"`
+	NearestFeedDistance *float64 `json:"nearestFeedDistance,omitempty"`
+}
+
+// CoverageReport shows where there are feeds and where demand has none.
+type CoverageReport struct {
+	GeneratedAt  time.Time      `json:"generatedAt"`
+	Suburbs      int            `json:"suburbs"`
+	Feeds        []FeedCoverage `json:"feeds"`
+	TotalLookups int            `json:"totalLookups"`
+	TotalMisses  int            `json:"totalMisses"`
+	Gaps         []CoverageGap  `json:"gaps"`
+}
+
+// buildCoverage reports every feed, counting the assets visible at now, and
+// up to limit of the most looked up suburbs that have no feed within
+// gapDistance.
+func buildCoverage(store Store, limit int, now time.Time) (CoverageReport, error) {
+	report := CoverageReport{GeneratedAt: now.UTC(), Feeds: []FeedCoverage{}, Gaps: []CoverageGap{}}
+
+	suburbs, err := store.SuburbsWithPrefix("", 0)
+	if err != nil {
+		return report, err
+	}
+	report.Suburbs = len(suburbs)
+
+	records, err := store.Feeds()
+	if err != nil {
+		return report, err
+	}
+
+	for _, r := range records {
+		assets := AssetFilter{Now: report.GeneratedAt}.apply(r.Assets)
+		feed := FeedCoverage{SuburbInfo: r.SuburbInfo, Assets: len(assets)}
+		for _, a := range assets {
+			if p := a.Dates.Published; p != nil && (feed.NewestPublished == nil || p.After(*feed.NewestPublished)) {
+				feed.NewestPublished = p
+			}
+		}
+		report.Feeds = append(report.Feeds, feed)
+	}
+
+	stats, err := store.Lookups()
+	if err != nil {
+		return report, err
+	}
+
+	for _, stat := range stats {
+		report.TotalLookups += stat.Lookups
+		report.TotalMisses += stat.Misses
+
+		gap := CoverageGap{SuburbInfo: stat.Suburb, Lookups: stat.Lookups, Misses: stat.Misses}
+
+		nearest, err := store.NearestFeeds(stat.Suburb.Lat, stat.Suburb.Lon, 1, 0)
+		if err != nil {
+			return report, err
+		}
+		if len(nearest) > 0 {
+			if nearest[0].Distance <= gapDistance {
+				continue
+			}
+			gap.NearestFeed = nearest[0].Name
+			gap.NearestFeedDistance = &nearest[0].Distance
+		}
+
+		report.Gaps = append(report.Gaps, gap)
+	}
+
+	sort.Slice(report.Gaps, func(i, j int) bool {
+		a, b := report.Gaps[i], report.Gaps[j]
+		if a.Lookups != b.Lookups {
+			return a.Lookups > b.Lookups
+		}
+		return a.location().Key() < b.location().Key()
+	})
+	if len(report.Gaps) > limit {
+		report.Gaps = report.Gaps[:limit]
+	}
+
+	return report, nil
+}
+
+// feedFeature and gapFeature tag the points of the GeoJSON report with
+// their kind, for styling on a map.
+type feedFeature struct {
+	Kind string `json:"kind"`
+	FeedCoverage
+}
+
+type gapFeature struct {
+	Kind string `json:"kind"`
+	CoverageGap
+}
+
+// geoJSON maps the feeds and gaps as points.
+func (c CoverageReport) geoJSON() GeoFeatureCollection {
+	collection := newFeatureCollection()
+	for _, f := range c.Feeds {
+		collection.Features = append(collection.Features, pointFeature(f.Lat, f.Lon, feedFeature{"feed", f}))
+	}
+	for _, g := range c.Gaps {
+		collection.Features = append(collection.Features, pointFeature(g.Lat, g.Lon, gapFeature{"gap", g}))
+	}
+	return collection
+}
+
+// coverageHandler serves /coverage, as JSON or GeoJSON.
+func (s *server) coverageHandler(w http.ResponseWriter, r *http.Request) {
+	limit, apiErr := parseBounded(r.URL.Query(), "limit", maxCoverageGaps)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if limit == 0 {
+		limit = defaultCoverageGaps
+	}
+
+	if err := s.lookups.flush(s.store); err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	report, err := buildCoverage(s.store, limit, s.clock())
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	s.writeFeed(w, r, report)
+}
+
+// coverageCommand prints the coverage report, for running as
+// "news_nearby coverage [-geojson] [-limit n]".
+func coverageCommand(store Store, args []string, out io.Writer, now clock) error {
+	flags := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	asGeoJSON := flags.Bool("geojson", false, "print the report as GeoJSON")
+	limit := flags.Int("limit", defaultCoverageGaps, "number of gaps to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *limit < 1 {
+		return fmt.Errorf("limit must be at least 1")
+	}
+
+	report, err := buildCoverage(store, *limit, now())
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if *asGeoJSON {
+		return enc.Encode(report.geoJSON())
+	}
+	return enc.Encode(report)
+}
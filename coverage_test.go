@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildCoverageUsesNow(t *testing.T) {
+	store := NewMemoryStore()
+	record := SuburbRecord{
+		SuburbInfo: SuburbInfo{Name: "Manly", State: "NSW", Postcode: "2095"},
+		Assets: []Asset{
+			{ID: "live", PublicState: "published", Dates: AssetDates{Published: timeAt(-time.Hour)}},
+			{ID: "embargoed", PublicState: "published", Dates: AssetDates{Published: timeAt(time.Hour)}},
+			{ID: "due", PublicState: "published", Dates: AssetDates{Published: timeAt(-time.Hour), TimeToTakeDown: timeAt(0)}},
+		},
+	}
+	if err := store.PutFeed(record); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := buildCoverage(store, defaultCoverageGaps, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.GeneratedAt.Equal(testNow) {
+		t.Errorf("generatedAt = %v, want %v", report.GeneratedAt, testNow)
+	}
+	if len(report.Feeds) != 1 || report.Feeds[0].Assets != 1 {
+		t.Fatalf("feeds = %+v, want Manly with 1 visible asset", report.Feeds)
+	}
+	if p := report.Feeds[0].NewestPublished; p == nil || !p.Equal(*timeAt(-time.Hour)) {
+		t.Errorf("newestPublished = %v, want %v", p, timeAt(-time.Hour))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned to clients, wrapped in an "error" object, whenever a
+// request cannot be answered.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code" description:"Machine readable error code."`
+	Message string `json:"message" description:"Human readable description of the error."`
+	Field   string `json:"field,omitempty" description:"Query parameter that caused the error, if any."`
+
+	Candidates  []SuburbInfo `json:"candidates,omitempty" description:"Suburbs the request could have meant."`
+	Suggestions []string     `json:"suggestions,omitempty" description:"Known suburb names close to the one asked for."`
+}
+
+func (e *APIError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Field)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// NotFoundError is returned by lookups when a key has no data.
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("failed to find data for '%s'", e.Key)
+}
+
+func missingParameter(field string, message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "missing_parameter", Message: message, Field: field}
+}
+
+func invalidParameter(field string, message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "invalid_parameter", Message: message, Field: field}
+}
+
+func notFound(message string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: "not_found", Message: message}
+}
+
+// ambiguous answers 300 Multiple Choices with the suburbs a name could refer
+// to, so the client can retry with a state or, for suburbs a state doesn't
+// tell apart, the candidate's place.
+func ambiguous(name string, candidates []SuburbInfo) *APIError {
+	field, places := "state", 0
+	for _, c := range candidates {
+		if c.Place != "" {
+			places++
+		}
+	}
+	switch {
+	case places == len(candidates):
+		field = "place"
+	case places > 0:
+		field = "state or place"
+	}
+
+	return &APIError{
+		Status:     http.StatusMultipleChoices,
+		Code:       "ambiguous_suburb",
+		Message:    fmt.Sprintf("'%s' matches %d suburbs, add %s to choose one", name, len(candidates), field),
+		Field:      strings.Replace(field, " or ", ",", 1),
+		Candidates: candidates,
+	}
+}
+
+// lookupError maps an error from the database onto the response the client
+// should see. Anything unexpected is logged and hidden behind a 500.
+func lookupError(err error) *APIError {
+	switch e := err.(type) {
+	case *APIError:
+		return e
+	case *NotFoundError:
+		return notFound(fmt.Sprintf("no feed data for '%s'", e.Key))
+	}
+
+	if err == bolt.ErrTimeout || err == bolt.ErrDatabaseNotOpen {
+		return &APIError{Status: http.StatusServiceUnavailable, Code: "unavailable", Message: "the database is busy, try again shortly"}
+	}
+
+	log.Printf("Request failed: %v", err)
+	return &APIError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "the request could not be completed"}
+}
+
+func writeError(w http.ResponseWriter, e *APIError) {
+	b, err := json.Marshal(struct {
+		Error *APIError `json:"error"`
+	}{e})
+	if err != nil {
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.Status)
+	w.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
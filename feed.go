@@ -0,0 +1,174 @@
+package main
+
+import "time"
+
+// FeedAsset is an asset tagged with the suburb it was taken from and, for
+// queries around a point, that suburb's distance from it in meters. Neighbour
+// is set when the suburb was asked for only as a neighbour of another.
+type FeedAsset struct {
+	Asset
+	Source    string   `json:"sourceSuburb"`
+	Distance  *float64 `json:"distance,omitempty"`
+	Neighbour bool     `json:"fromNeighbour,omitempty"`
+
+	suburbKey string
+}
+
+// SuburbFeed is a page of a single suburb's feed. Source, here and in the
+// other feeds around a point, is set as it is in Located.
+type SuburbFeed struct {
+	SuburbRecord
+	NextCursor string `json:"nextCursor,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+// FeedRecord is a page of a single suburb's feed along with its distance in
+// meters from the query point.
+type FeedRecord struct {
+	SuburbRecord
+	Distance   float64 `json:"distance"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+	Source     string  `json:"source,omitempty"`
+}
+
+// MergedSuburb is a suburb that contributed to a merged feed.
+type MergedSuburb struct {
+	SuburbInfo
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+// MergedFeed combines the feeds of several suburbs, such as those matched by
+// a k-nearest, radius or postcode query.
+type MergedFeed struct {
+	Suburbs    []MergedSuburb `json:"suburbs"`
+	Assets     []FeedAsset    `json:"assets"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	Source     string         `json:"source,omitempty"`
+}
+
+const maxMergedSuburbs = 50
+
+// maxRadius caps, in meters, how far around a point a radius query looks.
+const maxRadius = 50000
+
+// publishedAt is when an asset was last published, falling back to when it
+// was first published or created.
+func publishedAt(a Asset) time.Time {
+	switch {
+	case a.Dates.Published != nil:
+		return *a.Dates.Published
+	case a.Dates.FirstPublished != nil:
+		return *a.Dates.FirstPublished
+	}
+	return a.Dates.Created
+}
+
+// feedFor returns the feed for a location. A location without a state or
+// postcode may match feeds in several states, in which case the closest one
+// wins.
+func feedFor(store Store, loc Location) (SuburbRecord, error) {
+	records, err := store.FindFeeds(loc.Name, loc.State, loc.Postcode)
+	if err != nil {
+		return SuburbRecord{}, err
+	}
+
+	if len(records) == 0 {
+		return nearbySpelling(store, loc)
+	}
+
+	best := records[0]
+	for _, r := range records[1:] {
+		if distance(loc.Lat, loc.Lon, r.Lat, r.Lon) < distance(loc.Lat, loc.Lon, best.Lat, best.Lon) {
+			best = r
+		}
+	}
+	return best, nil
+}
+
+// sameSuburbRadius is how close a feed must be to a location to be taken for
+// the same suburb under another spelling.
+const sameSuburbRadius = 2000
+
+// nearbySpelling finds a feed for the location under a slightly different
+// name, since lat_lon and the feeds don't always agree on spelling (the
+// Parramatta feed is filed as "Paramatta").
+func nearbySpelling(store Store, loc Location) (SuburbRecord, error) {
+	if loc.Lat == 0 && loc.Lon == 0 {
+		return SuburbRecord{}, &NotFoundError{loc.Name}
+	}
+
+	nearby, err := store.NearestFeeds(loc.Lat, loc.Lon, 0, sameSuburbRadius)
+	if err != nil {
+		return SuburbRecord{}, err
+	}
+
+	want := foldName(loc.Name)
+	for _, n := range nearby {
+		if editDistance(want, foldName(n.Name)) <= maxEdits(want) && matches(n.info(), loc.State, loc.Postcode) {
+			return store.GetFeed(n.Key())
+		}
+	}
+
+	return SuburbRecord{}, &NotFoundError{loc.Name}
+}
+
+// feedMerger builds a MergedFeed one location at a time, skipping locations
+// without a feed or whose feed was already merged, up to maxMergedSuburbs.
+type feedMerger struct {
+	store Store
+	feed  MergedFeed
+	seen  map[string]bool
+}
+
+func newFeedMerger(store Store) *feedMerger {
+	return &feedMerger{
+		store: store,
+		feed:  MergedFeed{Suburbs: []MergedSuburb{}, Assets: []FeedAsset{}},
+		seen:  make(map[string]bool),
+	}
+}
+
+func (m *feedMerger) full() bool {
+	return len(m.feed.Suburbs) == maxMergedSuburbs
+}
+
+func (m *feedMerger) add(loc Location, dist *float64) {
+	if m.full() {
+		return
+	}
+
+	record, err := feedFor(m.store, loc)
+	if err != nil || m.seen[record.key()] {
+		return
+	}
+	m.seen[record.key()] = true
+
+	m.feed.Suburbs = append(m.feed.Suburbs, MergedSuburb{record.SuburbInfo, dist})
+	for _, a := range record.Assets {
+		m.feed.Assets = append(m.feed.Assets, FeedAsset{Asset: a, Source: record.Name, Distance: dist, suburbKey: record.key()})
+	}
+}
+
+// mergeFeeds collects the feeds of the neighbours, closest first.
+func mergeFeeds(store Store, neighbours []Neighbour) MergedFeed {
+	m := newFeedMerger(store)
+	for i := range neighbours {
+		if m.full() {
+			break
+		}
+		m.add(neighbours[i].Location, &neighbours[i].Distance)
+	}
+	return m.feed
+}
+
+// mergeSuburbFeeds collects the feeds of the suburbs in the order given.
+func mergeSuburbFeeds(store Store, suburbs []SuburbInfo) MergedFeed {
+	m := newFeedMerger(store)
+	for _, s := range suburbs {
+		if m.full() {
+			break
+		}
+		m.add(s.location(), nil)
+	}
+	return m.feed
+}
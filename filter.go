@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AssetFilter picks the assets of a feed a request asks for. Assets that
+// aren't published, are still drafts, are embargoed or have been taken down
+// as of Now are never shown.
+type AssetFilter struct {
+	Now               time.Time
+	Types             []string
+	Categories        []string
+	ExcludeCategories []string
+}
+
+// visible reports whether an asset may be shown to readers at all.
+func visible(a Asset, now time.Time) bool {
+	return strings.EqualFold(a.PublicState, "published") && !strings.EqualFold(a.EditingState, "draft") &&
+		!embargoed(a, now) && !expired(a, now)
+}
+
+// embargoed reports whether an asset is due to be published after now.
+func embargoed(a Asset, now time.Time) bool {
+	return a.Dates.Published != nil && a.Dates.Published.After(now)
+}
+
+// expired reports whether an asset was due to be taken down by now.
+func expired(a Asset, now time.Time) bool {
+	return a.Dates.TimeToTakeDown != nil && !a.Dates.TimeToTakeDown.After(now)
+}
+
+// keep reports whether the asset is visible, is one of the types asked for
+// and has one of the categories asked for and none of those excluded.
+func (f AssetFilter) keep(a Asset) bool {
+	if !visible(a, f.Now) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsFold(f.Types, a.AssetType) {
+		return false
+	}
+
+	if len(f.Categories) > 0 {
+		found := false
+		for _, c := range a.Categories {
+			if containsFold(f.Categories, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, c := range a.Categories {
+		if containsFold(f.ExcludeCategories, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the assets the filter keeps, in the same order.
+func (f AssetFilter) apply(assets []Asset) []Asset {
+	kept := []Asset{}
+	for _, a := range assets {
+		if f.keep(a) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// filter drops the assets of a merged feed the filter doesn't keep. Suburbs
+// stay listed even when none of their assets are left.
+func (f *MergedFeed) filter(filter AssetFilter) {
+	kept := []FeedAsset{}
+	for _, a := range f.Assets {
+		if filter.keep(a.Asset) {
+			kept = append(kept, a)
+		}
+	}
+	f.Assets = kept
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList reads a comma separated parameter, which may also be repeated.
+func parseList(query url.Values, field string) []string {
+	var values []string
+	for _, param := range query[field] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseAssetFilter reads the type, category and excludeCategory parameters
+// of a request made at now.
+func parseAssetFilter(query url.Values, now time.Time) (AssetFilter, *APIError) {
+	f := AssetFilter{
+		Now:               now,
+		Types:             parseList(query, "type"),
+		Categories:        parseList(query, "category"),
+		ExcludeCategories: parseList(query, "excludeCategory"),
+	}
+
+	for _, c := range f.Categories {
+		if containsFold(f.ExcludeCategories, c) {
+			return f, invalidParameter("excludeCategory", fmt.Sprintf("category '%s' is both included and excluded", c))
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testNow is the fixed time tests judge embargoes and take downs against.
+var testNow = time.Date(2018, 10, 20, 9, 0, 0, 0, time.UTC)
+
+func timeAt(d time.Duration) *time.Time {
+	t := testNow.Add(d)
+	return &t
+}
+
+func TestEmbargoed(t *testing.T) {
+	tests := []struct {
+		published *time.Time
+		want      bool
+	}{
+		{nil, false},
+		{timeAt(-time.Hour), false},
+		{timeAt(0), false},
+		{timeAt(time.Second), true},
+		{timeAt(24 * time.Hour), true},
+	}
+
+	for _, test := range tests {
+		a := Asset{Dates: AssetDates{Published: test.published}}
+		if got := embargoed(a, testNow); got != test.want {
+			t.Errorf("embargoed(published %v) = %v, want %v", test.published, got, test.want)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	tests := []struct {
+		takeDown *time.Time
+		want     bool
+	}{
+		{nil, false},
+		{timeAt(time.Second), false},
+		// An asset is gone from the moment it is due to be taken down.
+		{timeAt(0), true},
+		{timeAt(-time.Hour), true},
+	}
+
+	for _, test := range tests {
+		a := Asset{Dates: AssetDates{TimeToTakeDown: test.takeDown}}
+		if got := expired(a, testNow); got != test.want {
+			t.Errorf("expired(timeToTakeDown %v) = %v, want %v", test.takeDown, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// geoImportVersion is mixed into the source checksum so that a change to
+// how rows are parsed or keyed forces a fresh import.
+const geoImportVersion = 4
+
+// RejectedRow is a CSV row the importer could not turn into a Location.
+type RejectedRow struct {
+	Line   int      `json:"line"`
+	Record []string `json:"record,omitempty"`
+	Reason string   `json:"reason"`
+}
+
+// ImportReport summarises one run of the geo importer.
+type ImportReport struct {
+	Checksum  string        `json:"checksum"`
+	Skipped   bool          `json:"skipped"`
+	Inserted  int           `json:"inserted"`
+	Updated   int           `json:"updated"`
+	Deleted   int           `json:"deleted"`
+	Unchanged int           `json:"unchanged"`
+	Rejected  []RejectedRow `json:"rejected"`
+}
+
+func checksumKey(path string) string {
+	return "checksum:" + filepath.Base(path)
+}
+
+func rejectedKey(path string) string {
+	return "rejected:" + filepath.Base(path)
+}
+
+// geoColumns maps the fields of a location onto CSV columns. A column of -1
+// means the file does not have that field.
+type geoColumns struct {
+	name, state, postcode, lat, lon int
+}
+
+// legacyColumns is the layout of lat_lon.csv, which has no header and puts
+// any state at the end of the name.
+var legacyColumns = geoColumns{0, -1, -1, 1, 2}
+
+// headerColumns recognises a header row naming the columns, in any order.
+func headerColumns(row []string) (geoColumns, bool) {
+	cols := geoColumns{-1, -1, -1, -1, -1}
+	for i, field := range row {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "name", "suburb":
+			cols.name = i
+		case "state":
+			cols.state = i
+		case "postcode":
+			cols.postcode = i
+		case "lat", "latitude":
+			cols.lat = i
+		case "lon", "lng", "long", "longitude":
+			cols.lon = i
+		}
+	}
+
+	if cols.name < 0 || cols.lat < 0 || cols.lon < 0 {
+		return geoColumns{}, false
+	}
+	return cols, true
+}
+
+func (c geoColumns) width() int {
+	w := c.name
+	for _, i := range []int{c.state, c.postcode, c.lat, c.lon} {
+		if i > w {
+			w = i
+		}
+	}
+	return w + 1
+}
+
+func (c geoColumns) field(row []string, i int) string {
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// australia covers the mainland, Tasmania and the island territories.
+// lat_lon.csv also lists countries, such as the Congo that shares a name
+// with Congo NSW, and those are rejected.
+var australia = []BBox{
+	{-44.0, 112.0, -9.0, 154.0},  // mainland, Tasmania and the Torres Strait
+	{-31.6, 159.0, -31.5, 159.2}, // Lord Howe Island
+	{-29.2, 167.9, -28.9, 168.1}, // Norfolk Island
+	{-10.6, 105.5, -10.4, 105.8}, // Christmas Island
+	{-12.3, 96.8, -12.0, 97.0},   // Cocos (Keeling) Islands
+}
+
+func inAustralia(lat, lon float64) bool {
+	for _, b := range australia {
+		if b.contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGeoData reads locations from either the headerless name,lat,lon
+// layout or a CSV whose header names its columns. Rows that cannot be parsed
+// or lie outside Australia are returned as rejected rather than dropped.
+// Rows sharing a name, state and postcode are all kept, told apart by their
+// Place, and only a row repeating another's place too is rejected.
+func parseGeoData(r io.Reader) ([]Location, []RejectedRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var parsed []Location
+	var lines []int
+	var rows [][]string
+	var rejected []RejectedRow
+
+	cols := legacyColumns
+	count := make(map[string]int)
+	first := true
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if perr, ok := err.(*csv.ParseError); ok {
+			rejected = append(rejected, RejectedRow{perr.Line, row, perr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if first {
+			first = false
+			if header, ok := headerColumns(row); ok {
+				cols = header
+				continue
+			}
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(row) < cols.width() {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("expected %d fields, got %d", cols.width(), len(row))})
+			continue
+		}
+
+		latField, lonField := cols.field(row, cols.lat), cols.field(row, cols.lon)
+
+		lat, err := strconv.ParseFloat(latField, 64)
+		if err != nil {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("invalid lat '%s'", latField)})
+			continue
+		}
+
+		lon, err := strconv.ParseFloat(lonField, 64)
+		if err != nil {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("invalid lon '%s'", lonField)})
+			continue
+		}
+
+		if !inAustralia(lat, lon) {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("%g,%g is outside Australia", lat, lon)})
+			continue
+		}
+
+		name, state := splitState(cols.field(row, cols.name))
+		if s := cols.field(row, cols.state); s != "" {
+			state = strings.ToUpper(s)
+		}
+
+		loc := Location{Name: name, State: state, Postcode: cols.field(row, cols.postcode), Lat: lat, Lon: lon}
+		count[loc.Key()]++
+		parsed = append(parsed, loc)
+		lines = append(lines, line)
+		rows = append(rows, row)
+	}
+
+	var locations []Location
+	seen := make(map[string]int)
+	for i, loc := range parsed {
+		if count[loc.Key()] > 1 {
+			loc.Place = placeKey(loc.Lat, loc.Lon)
+		}
+
+		if prev, ok := seen[loc.Key()]; ok {
+			rejected = append(rejected, RejectedRow{lines[i], rows[i], fmt.Sprintf("duplicate of line %d", prev)})
+			continue
+		}
+		seen[loc.Key()] = lines[i]
+
+		locations = append(locations, loc)
+	}
+
+	return locations, rejected, nil
+}
+
+// importGeoData loads the CSV at path into the store in one batch. Nothing is
+// written when the file is unchanged since the last successful import.
+func importGeoData(path string, store Store) (ImportReport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "v%d\n", geoImportVersion)
+	hash.Write(b)
+	report := ImportReport{Checksum: hex.EncodeToString(hash.Sum(nil))}
+
+	if prev, err := store.GetMeta(checksumKey(path)); err == nil && prev == report.Checksum {
+		report.Skipped = true
+		return report, nil
+	}
+
+	locations, rejected, err := parseGeoData(bytes.NewReader(b))
+	if err != nil {
+		return report, err
+	}
+	report.Rejected = rejected
+
+	changes, err := store.PutLocations(locations)
+	if err != nil {
+		return report, err
+	}
+	report.Inserted, report.Updated, report.Deleted = changes.Inserted, changes.Updated, changes.Deleted
+	report.Unchanged = len(locations) - report.Inserted - report.Updated
+
+	enc, err := json.Marshal(rejected)
+	if err != nil {
+		return report, err
+	}
+	if err := store.PutMeta(rejectedKey(path), string(enc)); err != nil {
+		return report, err
+	}
+
+	// The checksum goes last so an interrupted import is retried.
+	return report, store.PutMeta(checksumKey(path), report.Checksum)
+}
+
+func loadGeoData(path string, store Store) error {
+	report, err := importGeoData(path, store)
+	if err != nil {
+		return err
+	}
+
+	if report.Skipped {
+		log.Printf("%s is unchanged, skipping import", path)
+		return nil
+	}
+
+	for _, r := range report.Rejected {
+		log.Printf("Rejected %s line %d: %s", path, r.Line, r.Reason)
+	}
+	log.Printf("Imported %s: %d inserted, %d updated, %d deleted, %d unchanged, %d rejected",
+		path, report.Inserted, report.Updated, report.Deleted, report.Unchanged, len(report.Rejected))
+	return nil
+}
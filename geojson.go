@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const geoJSONContentType = "application/geo+json"
+
+// GeoFeature is a GeoJSON feature.
+type GeoFeature struct {
+	Type       string      `json:"type"`
+	Geometry   GeoGeometry `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
+
+// GeoGeometry is a GeoJSON geometry. Coordinates are longitude first.
+type GeoGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// GeoFeatureCollection is a GeoJSON feature collection.
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+func pointFeature(lat, lon float64, properties interface{}) GeoFeature {
+	return GeoFeature{"Feature", GeoGeometry{"Point", []float64{lon, lat}}, properties}
+}
+
+func newFeatureCollection() GeoFeatureCollection {
+	return GeoFeatureCollection{Type: "FeatureCollection", Features: []GeoFeature{}}
+}
+
+// wantsGeoJSON reports whether the client asked for GeoJSON, with
+// format=geojson or by accepting application/geo+json.
+func wantsGeoJSON(r *http.Request) bool {
+	if strings.EqualFold(r.URL.Query().Get("format"), "geojson") {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), geoJSONContentType)
+}
+
+func writeGeoJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", geoJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
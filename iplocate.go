@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// locationSourceIP marks answers for a point worked out from the client's IP
+// address rather than sent by it.
+const locationSourceIP = "ip"
+
+// ipRange is a network and the approximate place its addresses are in.
+type ipRange struct {
+	first, last net.IP
+	lat, lon    float64
+	accuracy    float64
+}
+
+// IPLocations maps client addresses to approximate coordinates using a CSV
+// of networks, such as MaxMind's GeoLite2 City blocks. Networks are assumed
+// not to overlap.
+type IPLocations struct {
+	mu     sync.RWMutex
+	ranges []ipRange
+}
+
+// find returns the coordinates of the network containing ip, and how many
+// meters out they may be, when one is known.
+func (l *IPLocations) find(ip net.IP) (float64, float64, float64, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return 0, 0, 0, false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return bytes.Compare(l.ranges[i].first, ip) > 0
+	}) - 1
+
+	if i < 0 || bytes.Compare(ip, l.ranges[i].last) > 0 {
+		return 0, 0, 0, false
+	}
+	r := l.ranges[i]
+	return r.lat, r.lon, r.accuracy, true
+}
+
+func (l *IPLocations) swap(ranges []ipRange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ranges = ranges
+}
+
+// lastAddress is the highest address in a network.
+func lastAddress(n *net.IPNet) net.IP {
+	ip := n.IP.To16()
+	mask := n.Mask
+	if len(mask) == net.IPv4len {
+		mask = append(net.CIDRMask(96, 128)[:12], mask...)
+	}
+
+	last := make(net.IP, net.IPv6len)
+	for i := range ip {
+		last[i] = ip[i] | ^mask[i]
+	}
+	return last
+}
+
+// parseIPLocations reads a CSV whose header names a network column
+// ("network" or "cidr"), the latitude and longitude columns and, optionally,
+// an "accuracy_radius" in kilometers.
+func parseIPLocations(r io.Reader) ([]ipRange, []RejectedRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	network, lat, lon, accuracy := -1, -1, -1, -1
+	for i, field := range header {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "network", "cidr":
+			network = i
+		case "lat", "latitude":
+			lat = i
+		case "lon", "lng", "longitude":
+			lon = i
+		case "accuracy_radius":
+			accuracy = i
+		}
+	}
+	if network < 0 || lat < 0 || lon < 0 {
+		return nil, nil, fmt.Errorf("header must name network, latitude and longitude columns")
+	}
+
+	var ranges []ipRange
+	var rejected []RejectedRow
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			rejected = append(rejected, RejectedRow{perr.Line, row, perr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		field := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		_, n, err := net.ParseCIDR(field(network))
+		if err != nil {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("invalid network '%s'", field(network))})
+			continue
+		}
+
+		// GeoLite2 leaves the coordinates out for networks it only knows
+		// the country of.
+		if field(lat) == "" && field(lon) == "" {
+			continue
+		}
+
+		r := ipRange{first: n.IP.To16(), last: lastAddress(n)}
+		if r.lat, err = strconv.ParseFloat(field(lat), 64); err != nil {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("invalid latitude '%s'", field(lat))})
+			continue
+		}
+		if r.lon, err = strconv.ParseFloat(field(lon), 64); err != nil {
+			rejected = append(rejected, RejectedRow{line, row, fmt.Sprintf("invalid longitude '%s'", field(lon))})
+			continue
+		}
+		if km, err := strconv.ParseFloat(field(accuracy), 64); err == nil {
+			r.accuracy = km * 1000
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].first, ranges[j].first) < 0
+	})
+	return ranges, rejected, nil
+}
+
+// loadIPLocations replaces the networks with those in the CSV at path.
+// Without the file clients must send a location.
+func loadIPLocations(path string, locations *IPLocations) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No %s, IP geolocation is off", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ranges, rejected, err := parseIPLocations(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode '%s': %v", path, err)
+	}
+
+	for _, r := range rejected {
+		log.Printf("Rejected %s line %d: %s", path, r.Line, r.Reason)
+	}
+	log.Printf("Loaded %d networks from %s, %d rejected", len(ranges), path, len(rejected))
+
+	locations.swap(ranges)
+	return nil
+}
+
+// clientIP is the address the request came from. App Engine's load balancer
+// appends the address it saw and then its own to X-Forwarded-For, so the
+// client's is second from the end. Anything before it was sent by the client
+// and can't be trusted.
+func clientIP(r *http.Request) net.IP {
+	if header := r.Header.Get("X-Forwarded-For"); header != "" {
+		addrs := strings.Split(header, ",")
+		if len(addrs) >= 2 {
+			return net.ParseIP(strings.TrimSpace(addrs[len(addrs)-2]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// parsePoint reads the point a request is about. A request that gives none
+// falls back to the location of the client's IP address, if it is known, in
+// which case the source is locationSourceIP.
+func (s *server) parsePoint(r *http.Request) (lat float64, lon float64, source string, accuracy float64, apiErr *APIError) {
+	query := r.URL.Query()
+	if hasCoordinates(query) {
+		lat, lon, apiErr = parseCoordinates(query)
+		return lat, lon, "", 0, apiErr
+	}
+
+	if lat, lon, accuracy, ok := s.ipLocations.find(clientIP(r)); ok {
+		return lat, lon, locationSourceIP, accuracy, nil
+	}
+
+	_, _, apiErr = parseCoordinates(query)
+	return 0, 0, "", 0, apiErr
+}
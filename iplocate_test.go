@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		forwarded string
+		want      string
+	}{
+		{"", "10.0.0.1"},
+		{"203.0.113.7, 130.211.0.1", "203.0.113.7"},
+		// The client can prepend whatever it likes.
+		{"1.2.3.4, 203.0.113.7, 130.211.0.1", "203.0.113.7"},
+		{"1.2.3.4,203.0.113.7,130.211.0.1", "203.0.113.7"},
+		{"2001:db8::1, 130.211.0.1", "2001:db8::1"},
+		// A lone address didn't come through the load balancer.
+		{"1.2.3.4", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:54321"}
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := clientIP(r); got.String() != test.want {
+			t.Errorf("clientIP(X-Forwarded-For: %q) = %v, want %s", test.forwarded, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// kdTree is a static 3-d tree over locations projected onto the unit sphere.
+// Straight-line (chord) distance between two points on the sphere grows with
+// their great-circle distance, so the closest point in the tree is also the
+// closest point according to distance().
+type kdTree struct {
+	root      *kdNode
+	locations []Location
+}
+
+type kdNode struct {
+	loc   Location
+	point [3]float64
+	axis  int
+	left  *kdNode
+	right *kdNode
+}
+
+func toCartesian(lat, lon float64) [3]float64 {
+	la := lat * math.Pi / 180
+	lo := lon * math.Pi / 180
+	return [3]float64{
+		math.Cos(la) * math.Cos(lo),
+		math.Cos(la) * math.Sin(lo),
+		math.Sin(la),
+	}
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+func newKDTree(locations []Location) *kdTree {
+	nodes := make([]kdNode, len(locations))
+	ptrs := make([]*kdNode, len(locations))
+	for i, l := range locations {
+		nodes[i] = kdNode{loc: l, point: toCartesian(l.Lat, l.Lon)}
+		ptrs[i] = &nodes[i]
+	}
+
+	return &kdTree{root: buildKDTree(ptrs, 0), locations: locations}
+}
+
+func buildKDTree(nodes []*kdNode, depth int) *kdNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	axis := depth % 3
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].point[axis] < nodes[j].point[axis]
+	})
+
+	mid := len(nodes) / 2
+	n := nodes[mid]
+	n.axis = axis
+	n.left = buildKDTree(nodes[:mid], depth+1)
+	n.right = buildKDTree(nodes[mid+1:], depth+1)
+	return n
+}
+
+// Neighbour is a location found near a query point, with its distance in
+// meters as computed by distance().
+type Neighbour struct {
+	Location
+	Distance float64 `json:"distance"`
+}
+
+// chordForRadius converts a great-circle distance in meters into the squared
+// chord length on the unit sphere used by the tree.
+func chordForRadius(radius float64) float64 {
+	c := 2 * math.Sin(radius/(2*earthRadius))
+	return c * c
+}
+
+func (t *kdTree) nearest(lat, lon float64) (Location, bool) {
+	found := t.search(lat, lon, 1, 0)
+	if len(found) == 0 {
+		return Location{}, false
+	}
+	return found[0].Location, true
+}
+
+// search returns up to k locations within radius meters of the point, closest
+// first. A k of zero means no limit and a radius of zero means no bound, but
+// at least one of the two should be set.
+func (t *kdTree) search(lat, lon float64, k int, radius float64) []Neighbour {
+	if t == nil || t.root == nil {
+		return nil
+	}
+
+	type candidate struct {
+		node *kdNode
+		dist float64
+	}
+
+	target := toCartesian(lat, lon)
+	bound := math.MaxFloat64
+	if radius > 0 && radius < math.Pi*earthRadius {
+		bound = chordForRadius(radius)
+	}
+
+	var found []candidate
+
+	limit := func() float64 {
+		if k > 0 && len(found) == k {
+			return found[k-1].dist
+		}
+		return bound
+	}
+
+	var visit func(n *kdNode)
+	visit = func(n *kdNode) {
+		if n == nil {
+			return
+		}
+
+		if d := squaredDistance(n.point, target); d <= limit() {
+			i := sort.Search(len(found), func(i int) bool { return found[i].dist > d })
+			found = append(found, candidate{})
+			copy(found[i+1:], found[i:])
+			found[i] = candidate{n, d}
+			if k > 0 && len(found) > k {
+				found = found[:k]
+			}
+		}
+
+		diff := target[n.axis] - n.point[n.axis]
+		near, far := n.left, n.right
+		if diff > 0 {
+			near, far = far, near
+		}
+
+		visit(near)
+		if diff*diff <= limit() {
+			visit(far)
+		}
+	}
+	visit(t.root)
+
+	neighbours := make([]Neighbour, len(found))
+	for i, c := range found {
+		loc := c.node.loc
+		neighbours[i] = Neighbour{loc, distance(lat, lon, loc.Lat, loc.Lon)}
+	}
+	return neighbours
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"net/http"
+)
+
+const (
+	resolvedByBoundary = "boundary"
+	resolvedByNearest  = "nearest"
+
+	// confidentDistance is how far from the nearest suburb's centre a point
+	// can be before confidence in it falls off sharply.
+	confidentDistance = 5000
+
+	// maxNearestConfidence keeps a match by nearest centre below one inside
+	// a boundary.
+	maxNearestConfidence = 0.9
+
+	// defaultIPAccuracy is assumed, in meters, for IP locations that don't
+	// say how accurate they are.
+	defaultIPAccuracy = 50000
+)
+
+// Resolution is the suburb a point was resolved to, how, and how sure that
+// is, from 0 to 1.
+type Resolution struct {
+	Location   Location
+	Method     string
+	Distance   float64
+	Confidence float64
+}
+
+// resolve finds the suburb a point is in: the one whose boundary contains
+// it or, failing that, the one with the nearest centre. The feed endpoints
+// and /locate both go through here so they always agree.
+func (s *server) resolve(lat float64, lon float64) (Resolution, error) {
+	if b, ok := s.boundaries.find(lat, lon); ok {
+		loc, ok := boundaryLocation(s.store, b)
+		if !ok {
+			loc = b.location()
+			loc.Lat, loc.Lon = b.center()
+		}
+		return Resolution{loc, resolvedByBoundary, distance(lat, lon, loc.Lat, loc.Lon), 1}, nil
+	}
+
+	nearest, err := s.store.NearestLocations(lat, lon, 2, 0)
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	if len(nearest) == 0 {
+		return Resolution{}, notFound("no suburbs are loaded")
+	}
+
+	res := Resolution{nearest[0].Location, resolvedByNearest, nearest[0].Distance, maxNearestConfidence}
+	res.Confidence *= math.Exp(-res.Distance / confidentDistance)
+
+	// A point about as close to another suburb could be in either.
+	if len(nearest) > 1 && nearest[1].Distance > 0 {
+		res.Confidence *= nearest[1].Distance / (nearest[0].Distance + nearest[1].Distance)
+	}
+	return res, nil
+}
+
+// Located is the response of /locate. Source is set when the point came
+// from the client's IP address.
+type Located struct {
+	SuburbInfo
+	Source     string  `json:"source,omitempty"`
+	Method     string  `json:"method"`
+	Distance   float64 `json:"distance"`
+	Confidence float64 `json:"confidence"`
+	HasFeed    bool    `json:"hasFeed"`
+}
+
+// locateHandler serves /locate, the suburb a point is in without its feed.
+func (s *server) locateHandler(w http.ResponseWriter, r *http.Request) {
+	lat, lon, source, accuracy, apiErr := s.parsePoint(r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	res, err := s.resolve(lat, lon)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	// An IP address only places the client somewhere in a wide area.
+	if source == locationSourceIP {
+		if accuracy == 0 {
+			accuracy = defaultIPAccuracy
+		}
+		res.Confidence *= confidentDistance / (confidentDistance + accuracy)
+	}
+
+	record, err := feedFor(s.store, res.Location)
+	if _, missing := err.(*NotFoundError); err != nil && !missing {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	// lat_lon leaves out the state and postcode of most suburbs, which their
+	// feed may know.
+	info := res.Location.info()
+	if err == nil {
+		if info.State == "" {
+			info.State = record.State
+		}
+		if info.Postcode == "" {
+			info.Postcode = record.Postcode
+		}
+	}
+
+	writeJSON(w, Located{
+		SuburbInfo: info,
+		Source:     source,
+		Method:     res.Method,
+		Distance:   res.Distance,
+		Confidence: math.Round(res.Confidence*100) / 100,
+		HasFeed:    err == nil,
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// states are the suffixes lat_lon.csv appends to suburb names that occur in
+// more than one state, e.g. "Richmond VIC".
+var states = []string{"NSW", "VIC", "QLD", "TAS", "SA", "WA", "NT", "ACT"}
+
+type Location struct {
+	Name     string  `json:"suburb"`
+	State    string  `json:"state,omitempty"`
+	Postcode string  `json:"postcode,omitempty"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	// Place tells apart rows of lat_lon.csv that would otherwise share a
+	// key, such as the three Bellfields without a state. It is their
+	// coordinates rounded by placeKey and is empty for everything else.
+	Place string `json:"place,omitempty"`
+}
+
+// Key identifies the location in the lat_lon bucket.
+func (l Location) Key() string {
+	key := locationKey(l.Name, l.State, l.Postcode)
+	if l.Place != "" {
+		key += "|" + l.Place
+	}
+	return key
+}
+
+// placeKey rounds coordinates to two decimals, about a kilometre, which is
+// enough to tell apart suburbs that share a name.
+func placeKey(lat, lon float64) string {
+	return fmt.Sprintf("%.2f,%.2f", lat, lon)
+}
+
+// locationKey joins the parts that tell apart suburbs sharing a name. Keys
+// for the same name share the "name|" prefix so they can be scanned
+// together, and the name is folded so lookups ignore case and abbreviations.
+func locationKey(name string, state string, postcode string) string {
+	return namePrefix(name) + state + "|" + postcode
+}
+
+func namePrefix(name string) string {
+	return foldName(name) + "|"
+}
+
+func isState(s string) bool {
+	for _, st := range states {
+		if s == st {
+			return true
+		}
+	}
+	return false
+}
+
+// splitState separates a trailing state abbreviation from a suburb name.
+func splitState(name string) (string, string) {
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name, ""
+	}
+
+	if suffix := strings.ToUpper(name[i+1:]); isState(suffix) {
+		return name[:i], suffix
+	}
+	return name, ""
+}
+
+// matches reports whether a stored suburb is consistent with the state and
+// postcode asked for. Empty values on either side match anything.
+func matches(info SuburbInfo, state string, postcode string) bool {
+	if state != "" && info.State != "" && !strings.EqualFold(state, info.State) {
+		return false
+	}
+	if postcode != "" && info.Postcode != "" && postcode != info.Postcode {
+		return false
+	}
+	return true
+}
+
+func (l Location) info() SuburbInfo {
+	return SuburbInfo{l.Name, l.State, l.Postcode, l.Lat, l.Lon, l.Place}
+}
+
+func (i SuburbInfo) location() Location {
+	return Location{Name: i.Name, State: i.State, Postcode: i.Postcode, Lat: i.Lat, Lon: i.Lon, Place: i.Place}
+}
+
+func (r SuburbRecord) key() string {
+	return locationKey(r.Name, r.State, r.Postcode)
+}
@@ -1,353 +1,567 @@
 package main
 
 import (
-	"bufio"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	bolt "go.etcd.io/bbolt"
-	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"syscall"
+	"time"
 	"unicode"
 )
 
-type Location struct {
-	Name string  `json:"suburb"`
-	Lat  float64 `json:"lat"`
-	Lon  float64 `json:"lon"`
-}
-
-type Comparison struct {
-	Key      string
-	Distance float64
-}
+const earthRadius = 6378100 // Earth radius in meters
 
-func setupDb(name string) {
-	db, err := bolt.Open(name, 0600, nil)
-	if err != nil {
-		log.Fatal(err)
+func upperCaseFirst(str string) string {
+	for i, v := range str {
+		return string(unicode.ToUpper(v)) + str[i+1:]
 	}
-	defer db.Close()
+	return ""
 }
 
-func parseGeoData(filePath string) ([]Location, error) {
-	csvFile, err := os.Open(filePath)
+func loadFeedData(dir string, store Store) {
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
-	var locations []Location
+	for _, f := range files {
+		var err error
 
-loop:
-	for {
-		row, err := reader.Read()
-		switch {
-		case err == io.EOF:
-			break loop
-		case err != nil:
+		path := filepath.Join(dir, f.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
 			log.Fatal(err)
 		}
 
-		lat, err := strconv.ParseFloat(row[1], 64)
-		if err != nil {
-			continue
+		var record SuburbRecord
+		if err := json.Unmarshal(b, &record); err != nil {
+			log.Fatalf("Failed to decode %s: %v", path, err)
 		}
 
-		lon, err := strconv.ParseFloat(row[2], 64)
-		if err != nil {
-			continue
+		// Feeds are keyed by the suburb in the record, falling back to the
+		// file name for records that don't say.
+		if record.Name == "" {
+			fname := upperCaseFirst(f.Name())
+			extn := filepath.Ext(f.Name())
+			record.Name = fname[0 : len(fname)-len(extn)]
 		}
 
-		locations = append(locations, Location{row[0], lat, lon})
+		err = store.PutFeed(record)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
+}
 
-	return locations, nil
+func haversine(theta float64) float64 {
+	return math.Pow(math.Sin(theta/2), 2)
 }
 
-func insertToDb(loc Location, bucketName string, dbName string) error {
-	db, err := bolt.Open(dbName, 0600, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	// Convert to radians
+	// Must cast radius as float to multiply later
+	var la1, lo1, la2, lo2, r float64
+	la1 = lat1 * math.Pi / 180
+	lo1 = lon1 * math.Pi / 180
+	la2 = lat2 * math.Pi / 180
+	lo2 = lon2 * math.Pi / 180
 
-	return db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketName))
-		if err != nil {
-			return fmt.Errorf("failed to create bucket: %v", err)
-		}
+	r = earthRadius
 
-		enc, err := json.Marshal(loc)
-		if err != nil {
-			return fmt.Errorf("failed to encode location '%s': %v", loc.Name, err)
-		}
+	h := haversine(la2-la1) + math.Cos(la1)*math.Cos(la2)*haversine(lo2-lo1)
 
-		if err := bucket.Put([]byte(loc.Name), enc); err != nil {
-			return fmt.Errorf("failed to insert '%s': %v", loc.Name, err)
-		}
-		return nil
-	})
+	return 2 * r * math.Asin(math.Sqrt(h))
 }
 
-func loadGeoData(path string, dbName string) {
-	locations, err := parseGeoData(path)
-	if err != nil {
-		log.Fatal(err)
-	}
+// reloader reloads one of the data files.
+type reloader struct {
+	path string
+	load func(path string) error
+}
 
-	for _, l := range locations {
-		if err := insertToDb(l, "lat_lon", dbName); err != nil {
-			log.Println(err)
+func reloadOnSignal(reloaders ...reloader) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		for _, r := range reloaders {
+			log.Printf("Reloading %s", r.path)
+			if err := r.load(r.path); err != nil {
+				log.Printf("Failed to reload %s: %v", r.path, err)
+			}
 		}
 	}
 }
 
-func upperCaseFirst(str string) string {
-	for i, v := range str {
-		return string(unicode.ToUpper(v)) + str[i+1:]
-	}
-	return ""
+type server struct {
+	store       Store
+	boundaries  *Boundaries
+	regions     *Regions
+	neighbours  *NeighbourGraph
+	ipLocations *IPLocations
+	lookups     *LookupRecorder
+	clock       clock
+	bodies      BodyRenderer
 }
 
-func sanitizeKey(key string) string {
-	var out string
-	out = strings.Replace(key, " NSW", "", 1)
-	out = strings.Replace(out, " VIC", "", 1)
-	out = strings.Replace(out, " QLD", "", 1)
-	out = strings.Replace(out, " TAS", "", 1)
-	return out
+func newServer(store Store, boundaries *Boundaries, regions *Regions, neighbours *NeighbourGraph, ipLocations *IPLocations, lookups *LookupRecorder, clock clock, bodies BodyRenderer) *server {
+	return &server{store: store, boundaries: boundaries, regions: regions, neighbours: neighbours, ipLocations: ipLocations, lookups: lookups, clock: clock, bodies: bodies}
 }
 
-func saveToFeedDb(key string, data []byte, bucketName string, db *bolt.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+// lookupRecordAndWriteRequest answers with the feed for loc or, when it has
+// none and the request asks for fallback=neighbours, those of its neighbours.
+func (s *server) lookupRecordAndWriteRequest(loc Location, source string, w http.ResponseWriter, r *http.Request) {
+	fallback, apiErr := parseFallback(r.URL.Query().Get("fallback"))
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	filter, apiErr := parseAssetFilter(r.URL.Query(), s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	paging, apiErr := parsePaging(r.URL.Query(), 0)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	record, err := feedFor(s.store, loc)
+	_, missing := err.(*NotFoundError)
+	if err == nil || missing {
+		s.lookups.record(loc, err == nil)
+	}
+
+	if missing && fallback {
+		feed, err := s.neighbourFeed(loc)
 		if err != nil {
-			return fmt.Errorf("failed to create bucket: %v", err)
+			writeError(w, lookupError(err))
+			return
 		}
+		feed.filter(filter)
+		feed.paginate(paging)
+		feed.Source = source
+		s.writeFeed(w, r, feed)
+		return
+	}
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
 
-		if err := bucket.Put([]byte(key), data); err != nil {
-			return fmt.Errorf("failed to save to feed db '%s': %v", key, err)
-		}
-		return nil
-	})
+	feed := SuburbFeed{SuburbRecord: record, Source: source}
+	feed.Assets, feed.NextCursor = paging.pageAssets(filter.apply(record.Assets))
+	s.writeFeed(w, r, feed)
 }
 
-func loadFeedData(dir string, feedDB string) {
-	db, err := bolt.Open(feedDB, 0600, nil)
+// nearestFeedHandler answers with the closest suburb that has a feed, however
+// far away it is, and reports that distance.
+func (s *server) nearestFeedHandler(lat float64, lon float64, source string, w http.ResponseWriter, r *http.Request) {
+	filter, apiErr := parseAssetFilter(r.URL.Query(), s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	paging, apiErr := parsePaging(r.URL.Query(), 0)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	s.recordPointLookup(lat, lon)
+
+	nearest, err := s.store.NearestFeeds(lat, lon, 1, 0)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, lookupError(err))
+		return
 	}
-	defer db.Close()
 
-	files, err := ioutil.ReadDir(dir)
+	if len(nearest) == 0 {
+		writeError(w, notFound("no suburbs have feeds"))
+		return
+	}
+
+	record, err := s.store.GetFeed(nearest[0].Key())
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, lookupError(err))
+		return
 	}
 
-	for _, f := range files {
-		var err error
+	feed := FeedRecord{SuburbRecord: record, Distance: nearest[0].Distance, Source: source}
+	feed.Assets, feed.NextCursor = paging.pageAssets(filter.apply(record.Assets))
+	s.writeFeed(w, r, feed)
+}
 
-		path := filepath.Join(dir, f.Name())
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			log.Fatal(err)
-		}
+func (s *server) nearbyHandler(lat float64, lon float64, k int, radius float64, feedsOnly bool, source string, w http.ResponseWriter, r *http.Request) {
+	filter, apiErr := parseAssetFilter(r.URL.Query(), s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
-		fname := upperCaseFirst(f.Name())
-		extn := filepath.Ext(f.Name())
-		key := fname[0 : len(fname)-len(extn)]
+	paging, apiErr := parsePaging(r.URL.Query(), 0)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
-		err = saveToFeedDb(key, b, "feed_data", db)
-		if err != nil {
-			log.Fatal(err)
-		}
+	s.recordPointLookup(lat, lon)
+
+	// Only suburbs with a feed are merged, so a radius on its own, which can
+	// take in thousands of suburbs, only looks through those.
+	find := s.store.NearestLocations
+	if feedsOnly || k == 0 {
+		find = s.store.NearestFeeds
 	}
-}
 
-func lookupFeedData(key string, bucketName string, feedDB string) (SuburbRecord, error) {
-	db, err := bolt.Open(feedDB, 0600, nil)
+	neighbours, err := find(lat, lon, k, radius)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, lookupError(err))
+		return
 	}
-	defer db.Close()
 
-	var record SuburbRecord
+	feed := mergeFeeds(s.store, neighbours)
+	if len(feed.Suburbs) == 0 {
+		writeError(w, notFound("no suburbs with feeds match the query"))
+		return
+	}
 
-	dbErr := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(bucketName))
-		if bucket == nil {
-			return fmt.Errorf("failed to get '%s' bucket", bucketName)
-		}
+	feed.filter(filter)
+	feed.paginate(paging)
+	feed.Source = source
+	s.writeFeed(w, r, feed)
+}
 
-		b := bucket.Get([]byte(key))
-		if b == nil {
-			return fmt.Errorf("failed to find data for '%s'", key)
-		}
+const maxSuggestions = 5
 
-		if err := json.Unmarshal(b, &record); err != nil {
-			return fmt.Errorf("failed to unmarshal data for '%s'", key)
-		}
+// findSuburb returns the suburbs called name in lat_lon or, since not every
+// feed has an entry there, in the feeds. A place picks one of the lat_lon
+// suburbs that share a name, state and postcode.
+func (s *server) findSuburb(name string, state string, place string) ([]Location, error) {
+	locations, err := s.store.FindLocations(name, state, "")
+	if err != nil {
+		return nil, err
+	}
 
-		return nil
-	})
+	if place != "" {
+		var found []Location
+		for _, loc := range locations {
+			if loc.Place == place {
+				found = append(found, loc)
+			}
+		}
+		return found, nil
+	}
+	if len(locations) > 0 {
+		return locations, nil
+	}
 
-	return record, dbErr
+	records, err := s.store.FindFeeds(name, state, "")
+	for _, rec := range records {
+		locations = append(locations, rec.location())
+	}
+	return locations, err
 }
 
-func lookupGeoData(name string, bucketName string, db *bolt.DB) (Location, error) {
-	var loc Location
+// resolveSuburb looks a suburb up by name, optionally narrowed by state and
+// place. The state can also be given as a suffix, as in "Richmond VIC".
+// Misspelt names resolve to the closest known suburb when there is a clear
+// winner, whose name is returned as matched, or fail with suggestions
+// otherwise.
+func (s *server) resolveSuburb(suburbParam string, stateParam string, placeParam string) (loc Location, matched string, err error) {
+	name, state := normalizeSuburb(suburbParam)
+	if stateParam != "" {
+		state = strings.ToUpper(strings.TrimSpace(stateParam))
+	}
 
-	dbErr := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(bucketName))
-		if bucket == nil {
-			return fmt.Errorf("failed to get '%s' bucket", bucketName)
-		}
+	if state != "" && !isState(state) {
+		return Location{}, "", invalidParameter("state", fmt.Sprintf("state must be one of %s", strings.Join(states, ", ")))
+	}
 
-		b := bucket.Get([]byte(name))
-		if b == nil {
-			return fmt.Errorf("failed to find data for '%s'", name)
-		}
+	place := strings.TrimSpace(placeParam)
+
+	locations, err := s.findSuburb(name, state, place)
+	if err != nil {
+		return Location{}, "", err
+	}
 
-		if err := json.Unmarshal(b, &loc); err != nil {
-			return fmt.Errorf("failed to unmarshal data for '%s'", name)
+	if len(locations) == 0 {
+		names, err := s.store.SuburbNames()
+		if err != nil {
+			return Location{}, "", err
 		}
 
-		return nil
-	})
+		suggestions := fuzzyMatch(name, names, maxSuggestions)
+		if best, ok := bestMatch(suggestions); ok {
+			if locations, err = s.findSuburb(best, state, place); err != nil {
+				return Location{}, "", err
+			}
+			name = best
+		}
 
-	return loc, dbErr
-}
+		if len(locations) == 0 && place != "" {
+			return Location{}, "", notFound(fmt.Sprintf("no suburb called '%s' at '%s'", name, place))
+		}
+		if len(locations) == 0 {
+			apiErr := notFound(fmt.Sprintf("no suburb called '%s'", name))
+			apiErr.Suggestions = suggestionNames(suggestions)
+			return Location{}, "", apiErr
+		}
 
-func haversine(theta float64) float64 {
-	return math.Pow(math.Sin(theta/2), 2)
-}
+		matched = name
+	}
 
-func distance(lat1, lon1, lat2, lon2 float64) float64 {
-	// Convert to radians
-	// Must cast radius as float to multiply later
-	var la1, lo1, la2, lo2, r float64
-	la1 = lat1 * math.Pi / 180
-	lo1 = lon1 * math.Pi / 180
-	la2 = lat2 * math.Pi / 180
-	lo2 = lon2 * math.Pi / 180
+	if len(locations) > 1 {
+		// A name most often means the one suburb of that name with a feed,
+		// so that one answers without a state.
+		withFeed, err := suburbsWithFeed(s.store, locations)
+		if err != nil {
+			return Location{}, "", err
+		}
+		if len(withFeed) == 1 {
+			loc := withFeed[0]
+			return loc, strings.TrimSpace(loc.Name + " " + loc.State), nil
+		}
 
-	r = 6378100 // Earth radius in meters
+		candidates := make([]SuburbInfo, len(locations))
+		for i, l := range locations {
+			candidates[i] = l.info()
+		}
+		return Location{}, "", ambiguous(name, candidates)
+	}
 
-	h := haversine(la2-la1) + math.Cos(la1)*math.Cos(la2)*haversine(lo2-lo1)
+	return locations[0], matched, nil
+}
 
-	return 2 * r * math.Asin(math.Sqrt(h))
+// suburbsWithFeed returns the locations that have a feed.
+func suburbsWithFeed(store Store, locations []Location) ([]Location, error) {
+	var found []Location
+	for _, loc := range locations {
+		_, err := feedFor(store, loc)
+		if _, ok := err.(*NotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, loc)
+	}
+	return found, nil
 }
 
-func findNearest(lat float64, lon float64, bucketName string, dbName string) (Location, error) {
-	db, err := bolt.Open(dbName, 0600, nil)
+// suburbHandler answers with the feed of a suburb looked up by name.
+func (s *server) suburbHandler(suburbParam string, stateParam string, placeParam string, w http.ResponseWriter, r *http.Request) {
+	loc, matched, err := s.resolveSuburb(suburbParam, stateParam, placeParam)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, lookupError(err))
+		return
 	}
-	defer db.Close()
 
-	var comparisons []Comparison
+	if matched != "" {
+		w.Header().Set("X-Matched-Suburb", matched)
+	}
 
-	compareEach := func(key, value []byte) error {
-		var loc Location
-		if err := json.Unmarshal(value, &loc); err == nil {
-			comparisons = append(comparisons, Comparison{
-				string(key),
-				distance(lat, lon, loc.Lat, loc.Lon),
-			})
-		}
+	s.lookupRecordAndWriteRequest(loc, "", w, r)
+}
 
-		return nil
+// postcodeHandler merges the feeds of every suburb sharing a postcode.
+func (s *server) postcodeHandler(postcode string, w http.ResponseWriter, r *http.Request) {
+	if apiErr := validatePostcode(postcode); apiErr != nil {
+		writeError(w, apiErr)
+		return
 	}
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		b.ForEach(compareEach)
-		return nil
-	})
-
-	min := Comparison{"", math.MaxFloat64}
-	for _, c := range comparisons {
-		if c.Distance < min.Distance {
-			min = c
-		}
+	filter, apiErr := parseAssetFilter(r.URL.Query(), s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
 	}
 
-	return lookupGeoData(min.Key, "lat_lon", db)
-}
+	paging, apiErr := parsePaging(r.URL.Query(), 0)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
-func lookupRecordAndWriteRequest(key string, w http.ResponseWriter, r *http.Request) {
-	record, err := lookupFeedData(key, "feed_data", "news_nearby.db")
+	suburbs, err := s.store.FindPostcode(postcode)
 	if err != nil {
-		http.NotFound(w, r)
+		writeError(w, lookupError(err))
 		return
 	}
+	for _, suburb := range suburbs {
+		s.recordLookup(suburb.location())
+	}
 
-	b, err := json.Marshal(record)
-	if err != nil {
-		log.Fatal(err)
+	feed := mergeSuburbFeeds(s.store, suburbs)
+	if len(feed.Suburbs) == 0 {
+		writeError(w, notFound(fmt.Sprintf("no feed data for postcode '%s'", postcode)))
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(b)
+	feed.filter(filter)
+	feed.paginate(paging)
+	s.writeFeed(w, r, feed)
+}
+
+// postcodesHandler serves /postcodes/{code}.
+func (s *server) postcodesHandler(w http.ResponseWriter, r *http.Request) {
+	s.postcodeHandler(strings.TrimPrefix(r.URL.Path, "/postcodes/"), w, r)
 }
 
-func indexHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	paths := strings.Split(r.URL.Path, "/")
 
-	if len(paths) < 3 {
-		http.NotFound(w, r)
+	if len(paths) < 3 || paths[1] != "newsfeed" || paths[2] != "location" {
+		writeError(w, notFound(fmt.Sprintf("no such endpoint '%s'", r.URL.Path)))
 		return
 	}
 
-	if paths[1] != "newsfeed" || paths[2] != "location" {
-		http.NotFound(w, r)
+	query := r.URL.Query()
+
+	if postcode := query.Get("postcode"); postcode != "" {
+		s.postcodeHandler(postcode, w, r)
 		return
 	}
 
-	suburbParam := r.URL.Query().Get("suburb")
+	suburbParam := query.Get("suburb")
 	if suburbParam != "" {
-		k := upperCaseFirst(suburbParam)
-		s := sanitizeKey(k)
-		lookupRecordAndWriteRequest(s, w, r)
+		s.suburbHandler(suburbParam, query.Get("state"), query.Get("place"), w, r)
 		return
 	}
 
-	latParam := r.URL.Query().Get("lat")
-	lonParam := r.URL.Query().Get("lon")
+	lat, lon, source, _, apiErr := s.parsePoint(r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if source != "" {
+		w.Header().Set("X-Location-Source", source)
+	}
+
+	feedsOnly := false
+	switch query.Get("nearest") {
+	case "", "suburb":
+	case "feed":
+		feedsOnly = true
+	default:
+		writeError(w, invalidParameter("nearest", "nearest must be 'suburb' or 'feed'"))
+		return
+	}
+
+	k, radius, apiErr := parseNearbyParams(query)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
-	lat, err := strconv.ParseFloat(latParam, 64)
+	if k != 0 || radius != 0 {
+		s.nearbyHandler(lat, lon, k, radius, feedsOnly, source, w, r)
+		return
+	}
+
+	if feedsOnly {
+		s.nearestFeedHandler(lat, lon, source, w, r)
+		return
+	}
+
+	res, err := s.resolve(lat, lon)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, lookupError(err))
+		return
+	}
+
+	s.lookupRecordAndWriteRequest(res.Location, source, w, r)
+}
+
+const dbPath = "news_nearby.db"
+
+// runCoverage opens the database read-only for the coverage command. bbolt
+// locks the file while the server has it open, so rather than wait for it
+// the command gives up quickly.
+func runCoverage(args []string) error {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("%s is in use by the server, ask it for /coverage instead", dbPath)
+	}
+	if err != nil {
+		return err
 	}
+	defer db.Close()
 
-	lon, err := strconv.ParseFloat(lonParam, 64)
+	store, err := NewReadOnlyBoltStore(db)
+	if err != nil {
+		return err
+	}
+	return coverageCommand(store, args, os.Stdout, time.Now)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "coverage" {
+		if err := runCoverage(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 10 * time.Second})
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
 
-	nearest, err := findNearest(lat, lon, "lat_lon", "news_nearby.db")
+	store, err := NewBoltStore(db)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sanitized := sanitizeKey(nearest.Name)
+	if err := loadGeoData("lat_lon.csv", store); err != nil {
+		log.Fatal(err)
+	}
+	loadFeedData("./rawdata", store)
 
-	lookupRecordAndWriteRequest(sanitized, w, r)
-}
+	boundaries := &Boundaries{}
+	if err := loadBoundaries("boundaries.geojson", boundaries); err != nil {
+		log.Fatal(err)
+	}
 
-func main() {
-	setupDb("news_nearby.db")
-	loadGeoData("lat_lon.csv", "news_nearby.db")
-	loadFeedData("./rawdata", "news_nearby.db")
+	neighbours := &NeighbourGraph{}
+	if err := loadNeighbourGraph(store, boundaries, neighbours); err != nil {
+		log.Fatal(err)
+	}
+
+	regions := &Regions{}
+	if err := loadRegions("regions.json", regions); err != nil {
+		log.Fatal(err)
+	}
+
+	ipLocations := &IPLocations{}
+	if err := loadIPLocations("ip_locations.csv", ipLocations); err != nil {
+		log.Fatal(err)
+	}
+
+	lookups := newLookupRecorder()
+	go lookups.flushEvery(store, time.Minute)
+	go sweepEvery(store, time.Minute, time.Now)
+
+	go reloadOnSignal(
+		reloader{"lat_lon.csv", func(path string) error { return loadGeoData(path, store) }},
+		reloader{"boundaries.geojson", func(path string) error { return loadBoundaries(path, boundaries) }},
+		reloader{"neighbour graph", func(string) error { return loadNeighbourGraph(store, boundaries, neighbours) }},
+		reloader{"regions.json", func(path string) error { return loadRegions(path, regions) }},
+		reloader{"ip_locations.csv", func(path string) error { return loadIPLocations(path, ipLocations) }},
+	)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -355,7 +569,18 @@ func main() {
 		log.Printf("Defaulting to port %s", port)
 	}
 
-	http.HandleFunc("/", indexHandler)
+	bodies := BodyRenderer{ImageBaseURL: os.Getenv("IMAGE_BASE_URL")}
+
+	srv := newServer(store, boundaries, regions, neighbours, ipLocations, lookups, time.Now, bodies)
+	http.HandleFunc("/", srv.indexHandler)
+	http.HandleFunc("/newsfeed/bbox", srv.bboxHandler)
+	http.HandleFunc("/newsfeed/clusters", srv.clusterHandler)
+	http.HandleFunc("/newsfeed/state/", srv.stateHandler)
+	http.HandleFunc("/newsfeed/region/", srv.regionHandler)
+	http.HandleFunc("/postcodes/", srv.postcodesHandler)
+	http.HandleFunc("/suburbs/", srv.suburbsHandler)
+	http.HandleFunc("/locate", srv.locateHandler)
+	http.HandleFunc("/coverage", srv.coverageHandler)
 
 	log.Printf("Listening on port %s", port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestServer serves testLocations along with the feeds given.
+func newTestServer(t *testing.T, feeds ...SuburbRecord) *server {
+	store := NewMemoryStore()
+	putTestLocations(t, store)
+	for _, feed := range feeds {
+		if err := store.PutFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := clock(func() time.Time { return testNow })
+	return newServer(store, &Boundaries{}, &Regions{}, &NeighbourGraph{}, &IPLocations{}, newLookupRecorder(), now, BodyRenderer{})
+}
+
+func testFeed(name, state, postcode string, lat, lon float64) SuburbRecord {
+	return SuburbRecord{
+		SuburbInfo: SuburbInfo{Name: name, State: state, Postcode: postcode, Lat: lat, Lon: lon},
+		Assets:     []Asset{{ID: name, PublicState: "published"}},
+	}
+}
+
+// serve answers a request for url and decodes the JSON response into v.
+func serve(t *testing.T, handler http.HandlerFunc, url string, v interface{}) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", url, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: %v in %s", url, err, w.Body)
+	}
+	return w
+}
+
+func TestIndexHandlerRadius(t *testing.T) {
+	s := newTestServer(t,
+		testFeed("Manly", "NSW", "2095", -33.7971, 151.2880),
+		testFeed("St Kilda", "VIC", "3182", -37.8676, 144.9809),
+	)
+
+	var feed struct {
+		Suburbs []SuburbInfo `json:"suburbs"`
+	}
+	w := serve(t, s.indexHandler, "/newsfeed/location?lat=-33.80&lon=151.28&radius=5000", &feed)
+	if w.Code != http.StatusOK || len(feed.Suburbs) != 1 || feed.Suburbs[0].Name != "Manly" {
+		t.Errorf("radius=5000 around Manly = %d %+v, want only Manly", w.Code, feed.Suburbs)
+	}
+}
+
+func TestIndexHandlerSuburb(t *testing.T) {
+	s := newTestServer(t,
+		testFeed("Manly", "NSW", "2095", -33.7971, 151.2880),
+		testFeed("Richmond", "NSW", "2753", -33.5994, 150.7516),
+		testFeed("Richmond", "VIC", "3121", -37.8233, 144.9987),
+	)
+	_, err := s.store.PutLocations(append(testLocations,
+		Location{Name: "Manly", State: "QLD", Lat: -27.4543, Lon: 153.1853},
+		Location{Name: "Bellfield", State: "VIC", Lat: -37.7518, Lon: 145.0454, Place: "-37.75,145.05"},
+		Location{Name: "Bellfield", State: "VIC", Lat: -37.2286, Lon: 142.4801, Place: "-37.23,142.48"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		status  int
+		matched string
+		field   string
+		message string
+	}{
+		{query: "suburb=Richmond&state=VIC", status: http.StatusOK},
+		{query: "suburb=Richmond%20NSW", status: http.StatusOK},
+		{query: "suburb=Richmond", status: http.StatusMultipleChoices, field: "state",
+			message: "'Richmond' matches 2 suburbs, add state to choose one"},
+		// Manly QLD has no feed, so Manly alone still means Manly NSW.
+		{query: "suburb=Manly", status: http.StatusOK, matched: "Manly NSW"},
+		{query: "suburb=Manly&state=QLD", status: http.StatusNotFound},
+		{query: "suburb=Richmund&state=VIC", status: http.StatusOK, matched: "Richmond"},
+		{query: "suburb=Bellfield", status: http.StatusMultipleChoices, field: "place",
+			message: "'Bellfield' matches 2 suburbs, add place to choose one"},
+		{query: "suburb=Bellfield&place=-37.75,145.05", status: http.StatusNotFound,
+			message: "no feed data for 'Bellfield'"},
+		{query: "suburb=Bellfield&place=-37.75,145.04", status: http.StatusNotFound,
+			message: "no suburb called 'Bellfield' at '-37.75,145.04'"},
+		{query: "suburb=Richmond&state=XX", status: http.StatusBadRequest, field: "state"},
+	}
+
+	for _, test := range tests {
+		var body struct {
+			Error *APIError `json:"error"`
+		}
+		w := serve(t, s.indexHandler, "/newsfeed/location?"+test.query, &body)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.query, w.Code, test.status)
+		}
+		if got := w.Header().Get("X-Matched-Suburb"); got != test.matched {
+			t.Errorf("%s: X-Matched-Suburb %q, want %q", test.query, got, test.matched)
+		}
+		if body.Error == nil {
+			continue
+		}
+		if body.Error.Field != test.field {
+			t.Errorf("%s: error field %q, want %q", test.query, body.Error.Field, test.field)
+		}
+		if test.message != "" && body.Error.Message != test.message {
+			t.Errorf("%s: error %q, want %q", test.query, body.Error.Message, test.message)
+		}
+	}
+}
+
+func TestIndexHandlerCoordinates(t *testing.T) {
+	s := newTestServer(t, testFeed("Manly", "NSW", "2095", -33.7971, 151.2880))
+
+	tests := []struct {
+		query  string
+		status int
+		field  string
+	}{
+		{"lat=-33.80&lon=151.28", http.StatusOK, ""},
+		{"lat=NaN&lon=151.28", http.StatusBadRequest, "lat"},
+		{"lat=-33.80&lon=nan", http.StatusBadRequest, "lon"},
+		{"lat=-Inf&lon=151.28", http.StatusBadRequest, "lat"},
+		{"lat=-33.80&lon=181", http.StatusBadRequest, "lon"},
+		{"lat=-33.80", http.StatusBadRequest, "lon"},
+		{"lat=-33.80&lon=151.28&radius=NaN", http.StatusBadRequest, "radius"},
+	}
+
+	for _, test := range tests {
+		var body struct {
+			Error *APIError `json:"error"`
+		}
+		w := serve(t, s.indexHandler, "/newsfeed/location?"+test.query, &body)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.query, w.Code, test.status)
+		}
+		if body.Error != nil && body.Error.Field != test.field {
+			t.Errorf("%s: error field %q, want %q", test.query, body.Error.Field, test.field)
+		}
+	}
+}
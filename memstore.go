@@ -0,0 +1,273 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps everything in maps. It is meant for
+// tests and for running without a database file, and returns results in the
+// same key order as BoltStore.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	locations map[string]Location
+	feeds     map[string]SuburbRecord
+	meta      map[string]string
+	lookups   map[string]LookupStat
+
+	locationIndex GeoIndex
+	feedIndex     GeoIndex
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		locations: make(map[string]Location),
+		feeds:     make(map[string]SuburbRecord),
+		meta:      make(map[string]string),
+		lookups:   make(map[string]LookupStat),
+	}
+	s.locationIndex.swap(newKDTree(nil))
+	s.feedIndex.swap(newKDTree(nil))
+	return s
+}
+
+func (s *MemoryStore) GetLocation(key string) (Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	loc, ok := s.locations[key]
+	if !ok {
+		return Location{}, &NotFoundError{key}
+	}
+	return loc, nil
+}
+
+func (s *MemoryStore) FindLocations(name string, state string, postcode string) ([]Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var locations []Location
+	for key, loc := range s.locations {
+		if strings.HasPrefix(key, namePrefix(name)) && matches(loc.info(), state, postcode) {
+			locations = append(locations, loc)
+		}
+	}
+
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].Key() < locations[j].Key()
+	})
+	return locations, nil
+}
+
+func (s *MemoryStore) GetFeed(key string) (SuburbRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.feeds[key]
+	if !ok {
+		return SuburbRecord{}, &NotFoundError{key}
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) FindFeeds(name string, state string, postcode string) ([]SuburbRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []SuburbRecord
+	for key, record := range s.feeds {
+		if strings.HasPrefix(key, namePrefix(name)) && matches(record.SuburbInfo, state, postcode) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].key() < records[j].key()
+	})
+	return records, nil
+}
+
+func (s *MemoryStore) SuburbsWithPrefix(prefix string, limit int) ([]Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p := foldName(prefix)
+	var found []Location
+	for key, loc := range s.locations {
+		if strings.HasPrefix(key, p) {
+			found = append(found, loc)
+		}
+	}
+	for key, record := range s.feeds {
+		if strings.HasPrefix(key, p) {
+			found = append(found, record.location())
+		}
+	}
+
+	return mergeSuburbs(limit, found), nil
+}
+
+func (s *MemoryStore) SuburbNames() ([]string, error) {
+	return locationNames(s.locationIndex.all(), s.feedIndex.all()), nil
+}
+
+func (s *MemoryStore) FindPostcode(postcode string) ([]SuburbInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[string]SuburbInfo)
+	for _, loc := range s.locations {
+		if loc.Postcode == postcode {
+			found[postcodeKey(loc.info())] = loc.info()
+		}
+	}
+	for _, record := range s.feeds {
+		if record.Postcode == postcode {
+			found[postcodeKey(record.SuburbInfo)] = record.SuburbInfo
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	suburbs := make([]SuburbInfo, len(keys))
+	for i, k := range keys {
+		suburbs[i] = found[k]
+	}
+	return suburbs, nil
+}
+
+func (s *MemoryStore) NearestLocations(lat, lon float64, k int, radius float64) ([]Neighbour, error) {
+	found, _ := s.locationIndex.search(lat, lon, k, radius)
+	return found, nil
+}
+
+func (s *MemoryStore) NearestFeeds(lat, lon float64, k int, radius float64) ([]Neighbour, error) {
+	found, _ := s.feedIndex.search(lat, lon, k, radius)
+	return found, nil
+}
+
+func (s *MemoryStore) Feeds() ([]SuburbRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.feeds))
+	for k := range s.feeds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	records := make([]SuburbRecord, len(keys))
+	for i, k := range keys {
+		records[i] = s.feeds[k]
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) FeedsInBox(box BBox) ([]Location, error) {
+	return inBox(box, s.feedIndex.all()), nil
+}
+
+func (s *MemoryStore) PutFeed(record SuburbRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds[record.key()] = record
+
+	var locations []Location
+	for _, r := range s.feeds {
+		if loc, ok := feedLocation(r); ok {
+			locations = append(locations, loc)
+		}
+	}
+	s.feedIndex.swap(newKDTree(locations))
+	return nil
+}
+
+func (s *MemoryStore) PutLocations(locations []Location) (LocationChanges, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes LocationChanges
+	keep := make(map[string]bool, len(locations))
+
+	for _, loc := range locations {
+		key := loc.Key()
+		keep[key] = true
+
+		prev, ok := s.locations[key]
+		switch {
+		case !ok:
+			changes.Inserted++
+		case prev == loc:
+			continue
+		default:
+			changes.Updated++
+		}
+		s.locations[key] = loc
+	}
+
+	for key := range s.locations {
+		if !keep[key] {
+			delete(s.locations, key)
+			changes.Deleted++
+		}
+	}
+
+	all := make([]Location, 0, len(s.locations))
+	for _, loc := range s.locations {
+		all = append(all, loc)
+	}
+	s.locationIndex.swap(newKDTree(all))
+	return changes, nil
+}
+
+func (s *MemoryStore) AddLookups(stats []LookupStat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stat := range stats {
+		prev := s.lookups[stat.key()]
+		prev.add(stat)
+		s.lookups[stat.key()] = prev
+	}
+	return nil
+}
+
+func (s *MemoryStore) Lookups() ([]LookupStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make([]LookupStat, 0, len(s.lookups))
+	for _, stat := range s.lookups {
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].key() < stats[j].key()
+	})
+	return stats, nil
+}
+
+func (s *MemoryStore) GetMeta(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.meta[key]
+	if !ok {
+		return "", &NotFoundError{key}
+	}
+	return value, nil
+}
+
+func (s *MemoryStore) PutMeta(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.meta[key] = value
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const (
+	// maxNeighbours and maxNeighbourDistance bound the suburbs taken as
+	// neighbours when there are no boundaries to say which ones touch.
+	maxNeighbours        = 8
+	maxNeighbourDistance = 10000
+
+	// vertexPrecision rounds boundary vertices, in degrees, before comparing
+	// them, since neighbouring polygons rarely agree to the last digit.
+	vertexPrecision = 1e-6
+)
+
+// NeighbourGraph links each suburb in lat_lon to the suburbs next to it:
+// those whose boundary shares an edge with its own or, for suburbs without
+// a boundary, its nearest suburbs.
+type NeighbourGraph struct {
+	mu    sync.RWMutex
+	edges map[string][]Neighbour
+}
+
+// neighbours returns the suburbs next to loc, closest first. Suburbs missing
+// from the graph, such as those only known from a feed, get their nearest.
+func (g *NeighbourGraph) neighbours(store Store, loc Location) ([]Neighbour, error) {
+	g.mu.RLock()
+	found, ok := g.edges[loc.Key()]
+	g.mu.RUnlock()
+
+	if ok {
+		return found, nil
+	}
+	return nearestNeighbours(store, loc)
+}
+
+func (g *NeighbourGraph) swap(edges map[string][]Neighbour) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.edges = edges
+}
+
+func nearestNeighbours(store Store, loc Location) ([]Neighbour, error) {
+	nearest, err := store.NearestLocations(loc.Lat, loc.Lon, maxNeighbours+1, maxNeighbourDistance)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []Neighbour{}
+	for _, n := range nearest {
+		if n.Key() != loc.Key() && len(found) < maxNeighbours {
+			found = append(found, n)
+		}
+	}
+	return found, nil
+}
+
+// boundaryLocation finds the lat_lon entry for a boundary, preferring one
+// that lies inside it.
+func boundaryLocation(store Store, b *Boundary) (Location, bool) {
+	locations, err := store.FindLocations(b.Name, b.State, b.Postcode)
+	if err != nil || len(locations) == 0 {
+		return Location{}, false
+	}
+
+	for _, loc := range locations {
+		if b.contains(loc.Lat, loc.Lon) {
+			return loc, true
+		}
+	}
+	return locations[0], true
+}
+
+type vertex struct {
+	lat, lon int64
+}
+
+// touching pairs up boundaries that share at least two vertices, and so an
+// edge.
+func touching(boundaries []*Boundary) map[int][]int {
+	owners := make(map[vertex][]int)
+	for i, b := range boundaries {
+		seen := make(map[vertex]bool)
+		for _, p := range b.polygons {
+			for _, r := range p {
+				for _, pt := range r {
+					v := vertex{int64(math.Round(pt[1] / vertexPrecision)), int64(math.Round(pt[0] / vertexPrecision))}
+					if !seen[v] {
+						seen[v] = true
+						owners[v] = append(owners[v], i)
+					}
+				}
+			}
+		}
+	}
+
+	shared := make(map[[2]int]int)
+	for _, ids := range owners {
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				shared[[2]int{ids[i], ids[j]}]++
+			}
+		}
+	}
+
+	adjacent := make(map[int][]int)
+	for pair, n := range shared {
+		if n >= 2 {
+			adjacent[pair[0]] = append(adjacent[pair[0]], pair[1])
+			adjacent[pair[1]] = append(adjacent[pair[1]], pair[0])
+		}
+	}
+	return adjacent
+}
+
+// buildNeighbourGraph links every suburb in the store to its neighbours.
+func buildNeighbourGraph(store Store, boundaries *Boundaries) (map[string][]Neighbour, error) {
+	locations, err := store.SuburbsWithPrefix("", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make(map[string][]Neighbour, len(locations))
+
+	all := boundaries.all()
+	located := make([]Location, len(all))
+	ok := make([]bool, len(all))
+	for i, b := range all {
+		located[i], ok[i] = boundaryLocation(store, b)
+	}
+
+	for i, adj := range touching(all) {
+		if !ok[i] {
+			continue
+		}
+		from := located[i]
+
+		var found []Neighbour
+		for _, j := range adj {
+			if ok[j] && located[j].Key() != from.Key() {
+				to := located[j]
+				found = append(found, Neighbour{to, distance(from.Lat, from.Lon, to.Lat, to.Lon)})
+			}
+		}
+
+		sort.Slice(found, func(a, b int) bool {
+			return found[a].Distance < found[b].Distance
+		})
+		edges[from.Key()] = found
+	}
+
+	for _, loc := range locations {
+		if _, ok := edges[loc.Key()]; ok {
+			continue
+		}
+		if edges[loc.Key()], err = nearestNeighbours(store, loc); err != nil {
+			return nil, err
+		}
+	}
+
+	return edges, nil
+}
+
+// loadNeighbourGraph rebuilds the graph from the current locations and
+// boundaries.
+func loadNeighbourGraph(store Store, boundaries *Boundaries, graph *NeighbourGraph) error {
+	edges, err := buildNeighbourGraph(store, boundaries)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Linked %d suburbs to their neighbours", len(edges))
+	graph.swap(edges)
+	return nil
+}
+
+// NeighbourSuburb is a suburb next to another.
+type NeighbourSuburb struct {
+	SuburbInfo
+	Distance float64 `json:"distance"`
+	HasFeed  bool    `json:"hasFeed"`
+}
+
+// NeighbourList is the response of /suburbs/{name}/neighbours.
+type NeighbourList struct {
+	Suburb     SuburbInfo        `json:"suburb"`
+	Neighbours []NeighbourSuburb `json:"neighbours"`
+}
+
+// neighboursHandler serves /suburbs/{name}/neighbours.
+func (s *server) neighboursHandler(name string, w http.ResponseWriter, r *http.Request) {
+	loc, matched, err := s.resolveSuburb(name, r.URL.Query().Get("state"), r.URL.Query().Get("place"))
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	if matched != "" {
+		w.Header().Set("X-Matched-Suburb", matched)
+	}
+
+	neighbours, err := s.neighbours.neighbours(s.store, loc)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	list := NeighbourList{Suburb: loc.info(), Neighbours: []NeighbourSuburb{}}
+	for _, n := range neighbours {
+		_, err := feedFor(s.store, n.Location)
+		list.Neighbours = append(list.Neighbours, NeighbourSuburb{n.info(), n.Distance, err == nil})
+	}
+
+	writeJSON(w, list)
+}
+
+// FallbackFeed answers for a suburb without a feed of its own with the feeds
+// of its neighbours.
+type FallbackFeed struct {
+	Suburb   SuburbInfo `json:"requestedSuburb"`
+	Fallback string     `json:"fallback"`
+	MergedFeed
+}
+
+// neighbourFeed merges the feeds of the suburbs next to loc, marking each
+// asset as coming from a neighbour.
+func (s *server) neighbourFeed(loc Location) (FallbackFeed, error) {
+	neighbours, err := s.neighbours.neighbours(s.store, loc)
+	if err != nil {
+		return FallbackFeed{}, err
+	}
+
+	feed := FallbackFeed{loc.info(), "neighbours", mergeFeeds(s.store, neighbours)}
+	if len(feed.Suburbs) == 0 {
+		return feed, notFound(fmt.Sprintf("no feed data for '%s' or its neighbours", loc.Name))
+	}
+
+	for i := range feed.Assets {
+		feed.Assets[i].Neighbour = true
+	}
+	return feed, nil
+}
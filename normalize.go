@@ -0,0 +1,211 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// foldWords maps alternative spellings of a word onto the one used when
+// comparing names, so "St Kilda" and "Saint Kilda" are the same suburb.
+var foldWords = map[string]string{
+	"saint": "st",
+	"mt":    "mount",
+}
+
+// displayWords are the spellings lat_lon.csv uses for abbreviated words.
+var displayWords = map[string]string{
+	"st":    "St",
+	"saint": "St",
+	"mt":    "Mount",
+	"mount": "Mount",
+}
+
+// smallWords stay lower case inside a title-cased name.
+var smallWords = map[string]bool{
+	"and": true,
+	"of":  true,
+}
+
+// nameWords splits a suburb name into lower-case words, dropping the
+// punctuation people add to abbreviations.
+func nameWords(name string) []string {
+	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ',', '_':
+			return ' '
+		}
+		return r
+	}, name)
+	return strings.Fields(name)
+}
+
+// foldName reduces a suburb name to the form used in store keys.
+func foldName(name string) string {
+	words := nameWords(name)
+	for i, w := range words {
+		if f, ok := foldWords[w]; ok {
+			words[i] = f
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// titleWord capitalises a word and each part of it after a hyphen or
+// apostrophe, as in "D'Aguilar".
+func titleWord(w string) string {
+	if d, ok := displayWords[w]; ok {
+		return d
+	}
+
+	upper := true
+	return strings.Map(func(r rune) rune {
+		if upper {
+			upper = false
+			return unicode.ToUpper(r)
+		}
+		if r == '-' || r == '\'' {
+			upper = true
+		}
+		return r
+	}, w)
+}
+
+// normalizeSuburb turns free text such as "st. kilda vic" into a display
+// name and state, "St Kilda" and "VIC".
+func normalizeSuburb(input string) (string, string) {
+	words := nameWords(input)
+
+	var state string
+	if n := len(words); n > 1 && isState(strings.ToUpper(words[n-1])) {
+		state = strings.ToUpper(words[n-1])
+		words = words[:n-1]
+	}
+
+	for i, w := range words {
+		if i > 0 && smallWords[w] {
+			continue
+		}
+		words[i] = titleWord(w)
+	}
+
+	return strings.Join(words, " "), state
+}
+
+// editDistance is the optimal string alignment distance between two names:
+// the insertions, deletions, substitutions and swaps of neighbouring letters
+// needed to turn one into the other. A swap counts as one edit, since "pyrmnot"
+// is a single slip of the fingers away from "pyrmont".
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < curr[j] {
+				curr[j] = d
+			}
+			if d := curr[j-1] + 1; d < curr[j] {
+				curr[j] = d
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if d := prev2[j-2] + 1; d < curr[j] {
+					curr[j] = d
+				}
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// maxEdits allows roughly one typo for every four letters.
+func maxEdits(name string) int {
+	n := len(name) / 4
+	switch {
+	case n < 1:
+		return 1
+	case n > 3:
+		return 3
+	}
+	return n
+}
+
+// Suggestion is a known suburb name close to one that was asked for.
+type Suggestion struct {
+	Name     string
+	Distance int
+}
+
+// fuzzyMatch returns up to limit of the names within maxEdits of query,
+// closest first. Names are compared in their folded form.
+func fuzzyMatch(query string, names []string, limit int) []Suggestion {
+	q := foldName(query)
+	max := maxEdits(q)
+
+	seen := make(map[string]bool)
+	var found []Suggestion
+
+	for _, name := range names {
+		f := foldName(name)
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		if diff := len(f) - len(q); diff > max || -diff > max {
+			continue
+		}
+
+		if d := editDistance(q, f); d <= max {
+			found = append(found, Suggestion{name, d})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Distance != found[j].Distance {
+			return found[i].Distance < found[j].Distance
+		}
+		return found[i].Name < found[j].Name
+	})
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+// bestMatch picks the suggestion to use in place of the query, if one is
+// clearly closer than the rest.
+func bestMatch(suggestions []Suggestion) (string, bool) {
+	if len(suggestions) == 0 {
+		return "", false
+	}
+	if len(suggestions) > 1 && suggestions[1].Distance == suggestions[0].Distance {
+		return "", false
+	}
+	return suggestions[0].Name, true
+}
+
+func suggestionNames(suggestions []Suggestion) []string {
+	names := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		names[i] = s.Name
+	}
+	return names
+}
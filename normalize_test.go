@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"pyrmont", "pyrmont", 0},
+		{"pyrmnot", "pyrmont", 1},
+		{"ypmront", "pyrmont", 2},
+		{"pyrmon", "pyrmont", 1},
+		{"pyrmonts", "pyrmont", 1},
+		{"pyrmant", "pyrmont", 1},
+		{"ca", "abc", 3},
+		{"", "manly", 5},
+		{"mánly", "manly", 1},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := editDistance(test.b, test.a); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyMatchSwappedLetters(t *testing.T) {
+	names := []string{"Pyrmont", "Pymble", "Manly", "Manly Vale"}
+
+	suggestions := fuzzyMatch("pyrmnot", names, maxSuggestions)
+	if best, ok := bestMatch(suggestions); !ok || best != "Pyrmont" {
+		t.Errorf("bestMatch(fuzzyMatch(pyrmnot)) = %q, %v, want Pyrmont", best, ok)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The orders a feed's assets can be sorted in.
+const (
+	sortPublished = "published"
+	sortModified  = "modified"
+	sortDistance  = "distance"
+)
+
+var sortOrders = []string{sortPublished, sortModified, sortDistance}
+
+const maxPageAssets = 200
+
+// modifiedAt is when an asset was last modified, falling back to when it was
+// published.
+func modifiedAt(a Asset) time.Time {
+	if a.Dates.Modified != nil {
+		return *a.Dates.Modified
+	}
+	return publishedAt(a)
+}
+
+// assetKey places an asset in a sort order. Ties are broken by asset ID and
+// then by the suburb the asset came from, so every asset has one place.
+type assetKey struct {
+	Time     time.Time `json:"t"`
+	Distance float64   `json:"d,omitempty"`
+	ID       string    `json:"id"`
+	Source   string    `json:"src,omitempty"`
+}
+
+// cursor is where the previous page left off, passed back as an opaque
+// token.
+type cursor struct {
+	Sort string `json:"s"`
+	assetKey
+}
+
+func (c cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(token string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// Paging is the sort order and page of a feed's assets a request asks for.
+// A zero Limit returns every asset after the cursor.
+type Paging struct {
+	Sort  string
+	Limit int
+	After *assetKey
+}
+
+func (p Paging) key(a Asset, dist *float64, source string) assetKey {
+	k := assetKey{Time: publishedAt(a), ID: a.ID, Source: source}
+	if p.Sort == sortModified {
+		k.Time = modifiedAt(a)
+	}
+	if p.Sort == sortDistance && dist != nil {
+		k.Distance = *dist
+	}
+	return k
+}
+
+// before reports whether a comes before b. Distances run nearest first, and
+// times newest first.
+func (p Paging) before(a, b assetKey) bool {
+	if p.Sort == sortDistance && a.Distance != b.Distance {
+		return a.Distance < b.Distance
+	}
+	if !a.Time.Equal(b.Time) {
+		return a.Time.After(b.Time)
+	}
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return a.Source < b.Source
+}
+
+// page sorts the keys and returns the indices of those on the page, in
+// order, and the cursor for the next page if there is one.
+func (p Paging) page(keys []assetKey) ([]int, string) {
+	order := make([]int, 0, len(keys))
+	for i, k := range keys {
+		if p.After == nil || p.before(*p.After, k) {
+			order = append(order, i)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return p.before(keys[order[i]], keys[order[j]])
+	})
+
+	if p.Limit == 0 || len(order) <= p.Limit {
+		return order, ""
+	}
+	order = order[:p.Limit]
+	return order, cursor{p.Sort, keys[order[len(order)-1]]}.String()
+}
+
+// pageAssets sorts a single suburb's assets and returns the page asked for.
+func (p Paging) pageAssets(assets []Asset) ([]Asset, string) {
+	keys := make([]assetKey, len(assets))
+	for i, a := range assets {
+		keys[i] = p.key(a, nil, "")
+	}
+
+	order, next := p.page(keys)
+	paged := make([]Asset, len(order))
+	for i, j := range order {
+		paged[i] = assets[j]
+	}
+	return paged, next
+}
+
+// paginate sorts the assets of a merged feed and keeps the page asked for.
+func (f *MergedFeed) paginate(p Paging) {
+	keys := make([]assetKey, len(f.Assets))
+	for i, a := range f.Assets {
+		keys[i] = p.key(a.Asset, a.Distance, a.suburbKey)
+	}
+
+	order, next := p.page(keys)
+	paged := make([]FeedAsset, len(order))
+	for i, j := range order {
+		paged[i] = f.Assets[j]
+	}
+	f.Assets, f.NextCursor = paged, next
+}
+
+// parsePaging reads the sort, limit and cursor parameters. Without a sort
+// the cursor's is used, and without either assets are newest first.
+func parsePaging(query url.Values, defaultLimit int) (Paging, *APIError) {
+	p := Paging{Sort: strings.ToLower(query.Get("sort"))}
+
+	if p.Sort != "" && !containsFold(sortOrders, p.Sort) {
+		return p, invalidParameter("sort", fmt.Sprintf("sort must be one of %s", strings.Join(sortOrders, ", ")))
+	}
+
+	limit, apiErr := parseBounded(query, "limit", maxPageAssets)
+	if apiErr != nil {
+		return p, apiErr
+	}
+	p.Limit = limit
+	if p.Limit == 0 {
+		p.Limit = defaultLimit
+	}
+
+	if token := query.Get("cursor"); token != "" {
+		c, err := parseCursor(token)
+		if err != nil || !containsFold(sortOrders, c.Sort) {
+			return p, invalidParameter("cursor", "cursor is not one given by this API")
+		}
+		if p.Sort != "" && p.Sort != c.Sort {
+			return p, invalidParameter("cursor", fmt.Sprintf("cursor is for sort=%s", c.Sort))
+		}
+		p.Sort = c.Sort
+		p.After = &c.assetKey
+	}
+
+	if p.Sort == "" {
+		p.Sort = sortPublished
+	}
+	return p, nil
+}
+
+// nextLink is the URL of the request with its cursor replaced.
+func nextLink(r *http.Request, next string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Set("cursor", next)
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=\"next\"", u.RequestURI())
+}
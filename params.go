@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// coordinateParams are the ways a point can be given, other than lat and
+// lon, and how to decode each.
+var coordinateParams = []struct {
+	field  string
+	decode func(string) (float64, float64, error)
+}{
+	{"geohash", decodeGeohash},
+	{"pluscode", decodePlusCode},
+	{"coords", parseDMS},
+}
+
+// hasCoordinates reports whether the query gives a point in any form.
+func hasCoordinates(query url.Values) bool {
+	if query.Get("lat") != "" || query.Get("lon") != "" {
+		return true
+	}
+	for _, p := range coordinateParams {
+		if query.Get(p.field) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCoordinates reads a point from exactly one of lat and lon in decimal
+// degrees, geohash, pluscode or coords in degrees, minutes and seconds.
+func parseCoordinates(query url.Values) (float64, float64, *APIError) {
+	latParam := query.Get("lat")
+	lonParam := query.Get("lon")
+
+	given := []string{}
+	if latParam != "" || lonParam != "" {
+		given = append(given, "lat/lon")
+	}
+	for _, p := range coordinateParams {
+		if query.Get(p.field) != "" {
+			given = append(given, p.field)
+		}
+	}
+
+	switch {
+	case len(given) == 0:
+		return 0, 0, missingParameter("lat", "pass either suburb, both lat and lon in decimal degrees, geohash, pluscode or coords")
+	case len(given) > 1:
+		return 0, 0, invalidParameter(given[1], fmt.Sprintf("pass only one of %s", strings.Join(given, ", ")))
+	}
+
+	for _, p := range coordinateParams {
+		if value := query.Get(p.field); value != "" {
+			lat, lon, err := p.decode(strings.TrimSpace(value))
+			if err != nil {
+				return 0, 0, invalidParameter(p.field, err.Error())
+			}
+			return lat, lon, nil
+		}
+	}
+
+	lat, apiErr := parseDegrees("lat", latParam, 90)
+	if apiErr != nil {
+		return 0, 0, apiErr
+	}
+
+	lon, apiErr := parseDegrees("lon", lonParam, 180)
+	if apiErr != nil {
+		return 0, 0, apiErr
+	}
+
+	return lat, lon, nil
+}
+
+func parseDegrees(field string, value string, limit float64) (float64, *APIError) {
+	if value == "" {
+		return 0, missingParameter(field, fmt.Sprintf("%s is required in decimal degrees", field))
+	}
+
+	deg, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(deg) || math.IsInf(deg, 0) {
+		return 0, invalidParameter(field, fmt.Sprintf("%s must be a decimal number, got '%s'", field, value))
+	}
+
+	if deg < -limit || deg > limit {
+		return 0, invalidParameter(field, fmt.Sprintf("%s must be between %v and %v", field, -limit, limit))
+	}
+
+	return deg, nil
+}
+
+// parseNearbyParams reads the optional k and radius query parameters. Zero
+// values mean the parameter was not given.
+func parseNearbyParams(query url.Values) (int, float64, *APIError) {
+	var k int
+	var radius float64
+	var err error
+
+	if kParam := query.Get("k"); kParam != "" {
+		k, err = strconv.Atoi(kParam)
+		if err != nil || k < 1 || k > maxMergedSuburbs {
+			return 0, 0, invalidParameter("k", fmt.Sprintf("k must be a whole number between 1 and %d", maxMergedSuburbs))
+		}
+	}
+
+	if radiusParam := query.Get("radius"); radiusParam != "" {
+		radius, err = strconv.ParseFloat(radiusParam, 64)
+		if err != nil || !(radius > 0 && radius <= maxRadius) {
+			return 0, 0, invalidParameter("radius", fmt.Sprintf("radius must be a positive number of meters, at most %d", maxRadius))
+		}
+	}
+
+	return k, radius, nil
+}
+
+// parseBBox reads the minLat, minLon, maxLat and maxLon query parameters.
+func parseBBox(query url.Values) (BBox, *APIError) {
+	var box BBox
+	var apiErr *APIError
+
+	if box.MinLat, apiErr = parseDegrees("minLat", query.Get("minLat"), 90); apiErr != nil {
+		return box, apiErr
+	}
+	if box.MinLon, apiErr = parseDegrees("minLon", query.Get("minLon"), 180); apiErr != nil {
+		return box, apiErr
+	}
+	if box.MaxLat, apiErr = parseDegrees("maxLat", query.Get("maxLat"), 90); apiErr != nil {
+		return box, apiErr
+	}
+	if box.MaxLon, apiErr = parseDegrees("maxLon", query.Get("maxLon"), 180); apiErr != nil {
+		return box, apiErr
+	}
+
+	if box.MinLat > box.MaxLat {
+		return box, invalidParameter("maxLat", "maxLat must not be less than minLat")
+	}
+	if box.MinLon > box.MaxLon {
+		return box, invalidParameter("maxLon", "maxLon must not be less than minLon")
+	}
+
+	return box, nil
+}
+
+// parseBounded reads an optional whole number query parameter between 1 and
+// max. Zero means the parameter was not given.
+func parseBounded(query url.Values, field string, max int) (int, *APIError) {
+	param := query.Get(field)
+	if param == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 1 || n > max {
+		return 0, invalidParameter(field, fmt.Sprintf("%s must be a whole number between 1 and %d", field, max))
+	}
+	return n, nil
+}
+
+// maxZoom is the closest zoom level of common web maps.
+const maxZoom = 22
+
+// parseZoom reads the optional map zoom level, reporting whether it was given.
+func parseZoom(query url.Values) (int, bool, *APIError) {
+	param := query.Get("zoom")
+	if param == "" {
+		return 0, false, nil
+	}
+
+	zoom, err := strconv.Atoi(param)
+	if err != nil || zoom < 0 || zoom > maxZoom {
+		return 0, false, invalidParameter("zoom", fmt.Sprintf("zoom must be a whole number between 0 and %d", maxZoom))
+	}
+	return zoom, true, nil
+}
+
+// parseFallback reads the optional fallback query parameter.
+func parseFallback(value string) (bool, *APIError) {
+	switch strings.ToLower(value) {
+	case "", "none":
+		return false, nil
+	case "neighbours", "neighbors":
+		return true, nil
+	}
+	return false, invalidParameter("fallback", "fallback must be 'neighbours' or 'none'")
+}
+
+// validatePostcode accepts the four digit Australian postcodes.
+func validatePostcode(postcode string) *APIError {
+	if len(postcode) != 4 {
+		return invalidParameter("postcode", "postcode must be 4 digits")
+	}
+	for _, c := range postcode {
+		if c < '0' || c > '9' {
+			return invalidParameter("postcode", "postcode must be 4 digits")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseDegrees(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		err   string
+	}{
+		{value: "-33.8", want: -33.8},
+		{value: "90", want: 90},
+		{value: "", err: "missing_parameter: lat is required in decimal degrees (lat)"},
+		{value: "north", err: "invalid_parameter: lat must be a decimal number, got 'north' (lat)"},
+		{value: "NaN", err: "invalid_parameter: lat must be a decimal number, got 'NaN' (lat)"},
+		{value: "Inf", err: "invalid_parameter: lat must be a decimal number, got 'Inf' (lat)"},
+		{value: "-infinity", err: "invalid_parameter: lat must be a decimal number, got '-infinity' (lat)"},
+		{value: "90.1", err: "invalid_parameter: lat must be between -90 and 90 (lat)"},
+	}
+
+	for _, test := range tests {
+		deg, apiErr := parseDegrees("lat", test.value, 90)
+		switch {
+		case test.err != "":
+			if apiErr == nil || apiErr.Error() != test.err {
+				t.Errorf("parseDegrees(%q) error = %v, want %q", test.value, apiErr, test.err)
+			}
+		case apiErr != nil:
+			t.Errorf("parseDegrees(%q) failed: %v", test.value, apiErr)
+		case deg != test.want:
+			t.Errorf("parseDegrees(%q) = %v, want %v", test.value, deg, test.want)
+		}
+	}
+}
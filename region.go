@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Region is a named group of suburbs, such as a local government area or an
+// editor's "Greater Sydney". A suburb belongs to it if it is in one of its
+// states, has one of its postcodes or is one of its suburbs.
+type Region struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type,omitempty"`
+	States    []string `json:"states,omitempty"`
+	Postcodes []string `json:"postcodes,omitempty"`
+	// Suburbs are names, optionally ending in a state as in "Richmond VIC".
+	Suburbs []string `json:"suburbs,omitempty"`
+
+	suburbs map[string][]string
+}
+
+// slug is the region's name as it appears in URLs, e.g. "greater-sydney".
+func (r *Region) slug() string {
+	return regionSlug(r.Name)
+}
+
+func regionSlug(name string) string {
+	return strings.Replace(foldName(name), " ", "-", -1)
+}
+
+func (r *Region) contains(info SuburbInfo) bool {
+	for _, st := range r.States {
+		if strings.EqualFold(st, info.State) {
+			return true
+		}
+	}
+
+	for _, pc := range r.Postcodes {
+		if pc == info.Postcode {
+			return true
+		}
+	}
+
+	states, ok := r.suburbs[foldName(info.Name)]
+	if !ok {
+		return false
+	}
+	for _, st := range states {
+		if matches(info, st, "") {
+			return true
+		}
+	}
+	return false
+}
+
+// Regions holds the regions loaded from the config file. A reload only
+// replaces them once the new set is ready.
+type Regions struct {
+	mu      sync.RWMutex
+	regions map[string]*Region
+}
+
+// find returns the region whose slug matches name.
+func (r *Regions) find(name string) (*Region, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	region, ok := r.regions[regionSlug(name)]
+	return region, ok
+}
+
+// list returns every region, ordered by slug.
+func (r *Regions) list() []*Region {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	regions := make([]*Region, 0, len(r.regions))
+	for _, region := range r.regions {
+		regions = append(regions, region)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].slug() < regions[j].slug()
+	})
+	return regions
+}
+
+func (r *Regions) swap(regions map[string]*Region) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.regions = regions
+}
+
+// parseRegions reads a list of regions, rejecting any without a name or
+// members, or whose name clashes with an earlier one.
+func parseRegions(b []byte) (map[string]*Region, error) {
+	var config struct {
+		Regions []*Region `json:"regions"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+
+	regions := make(map[string]*Region)
+	for i, region := range config.Regions {
+		slug := region.slug()
+		if slug == "" {
+			return nil, fmt.Errorf("region %d has no name", i)
+		}
+		if _, ok := regions[slug]; ok {
+			return nil, fmt.Errorf("region '%s' is defined twice", region.Name)
+		}
+		if len(region.States)+len(region.Postcodes)+len(region.Suburbs) == 0 {
+			return nil, fmt.Errorf("region '%s' has no states, postcodes or suburbs", region.Name)
+		}
+
+		for j, st := range region.States {
+			region.States[j] = strings.ToUpper(st)
+			if !isState(region.States[j]) {
+				return nil, fmt.Errorf("region '%s' has unknown state '%s'", region.Name, st)
+			}
+		}
+
+		region.suburbs = make(map[string][]string)
+		for _, s := range region.Suburbs {
+			name, state := splitState(s)
+			region.suburbs[foldName(name)] = append(region.suburbs[foldName(name)], state)
+		}
+
+		regions[slug] = region
+	}
+	return regions, nil
+}
+
+// loadRegions replaces the regions with those in the config file at path.
+// Without the file there are no regions.
+func loadRegions(path string, regions *Regions) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No %s, no regions defined", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded, err := parseRegions(b)
+	if err != nil {
+		return fmt.Errorf("failed to decode '%s': %v", path, err)
+	}
+
+	log.Printf("Loaded %d regions from %s", len(loaded), path)
+	regions.swap(loaded)
+	return nil
+}
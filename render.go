@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// geoFeed is a response that can also be written as GeoJSON.
+type geoFeed interface {
+	geoJSON() GeoFeatureCollection
+}
+
+// pagedFeed is a response that may be one page of several.
+type pagedFeed interface {
+	nextPage() string
+}
+
+func (f SuburbFeed) nextPage() string { return f.NextCursor }
+func (f FeedRecord) nextPage() string { return f.NextCursor }
+func (f MergedFeed) nextPage() string { return f.NextCursor }
+
+// writeFeed writes a feed response as JSON, with its assets in the view and
+// body format the client asks for, or, when the client asks for it and the
+// response supports it, as GeoJSON. Responses with a next page link to it in
+// a Link header.
+func (s *server) writeFeed(w http.ResponseWriter, r *http.Request, v interface{}) {
+	view, apiErr := parseView(r.URL.Query())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	resolve, apiErr := parseBodyFormat(r.URL.Query())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	if p, ok := v.(pagedFeed); ok && p.nextPage() != "" {
+		w.Header().Set("Link", nextLink(r, p.nextPage()))
+	}
+	if g, ok := v.(geoFeed); ok && wantsGeoJSON(r) {
+		writeGeoJSON(w, g.geoJSON())
+		return
+	}
+	if c, ok := v.(cardFeed); ok && view.Card {
+		v = c.cards(view)
+	} else if a, ok := v.(assetFeed); ok && resolve {
+		a.eachAsset(s.bodies.resolve)
+	}
+	writeJSON(w, v)
+}
+
+// AssetSummary is the part of an asset that goes on a map.
+type AssetSummary struct {
+	ID        string                `json:"id"`
+	Headline  string                `json:"headline"`
+	Published string                `json:"published,omitempty"`
+	URLs      AssetURLs             `json:"urls"`
+	Images    map[string]AssetImage `json:"featuredImages,omitempty"`
+	Neighbour bool                  `json:"fromNeighbour,omitempty"`
+}
+
+func summarise(a Asset) AssetSummary {
+	s := AssetSummary{ID: a.ID, Headline: a.Data.Headlines.Headline, URLs: a.URLs, Images: a.Images}
+	if t := publishedAt(a); !t.IsZero() {
+		s.Published = t.Format(time.RFC3339)
+	}
+	return s
+}
+
+// SuburbProperties are the properties of a suburb's feature.
+type SuburbProperties struct {
+	SuburbInfo
+	Distance *float64       `json:"distance,omitempty"`
+	Assets   []AssetSummary `json:"assets"`
+}
+
+func suburbFeature(info SuburbInfo, dist *float64, assets []AssetSummary) GeoFeature {
+	if assets == nil {
+		assets = []AssetSummary{}
+	}
+	return pointFeature(info.Lat, info.Lon, SuburbProperties{info, dist, assets})
+}
+
+func summariseAll(assets []Asset) []AssetSummary {
+	summaries := make([]AssetSummary, len(assets))
+	for i, a := range assets {
+		summaries[i] = summarise(a)
+	}
+	return summaries
+}
+
+func (r SuburbRecord) geoJSON() GeoFeatureCollection {
+	collection := newFeatureCollection()
+	collection.Features = append(collection.Features, suburbFeature(r.SuburbInfo, nil, summariseAll(r.Assets)))
+	return collection
+}
+
+func (r FeedRecord) geoJSON() GeoFeatureCollection {
+	collection := newFeatureCollection()
+	collection.Features = append(collection.Features, suburbFeature(r.SuburbInfo, &r.Distance, summariseAll(r.Assets)))
+	return collection
+}
+
+// geoJSON gives each suburb of a merged feed its own feature holding the
+// assets taken from it.
+func (f MergedFeed) geoJSON() GeoFeatureCollection {
+	bySuburb := make(map[string][]AssetSummary)
+	for _, a := range f.Assets {
+		s := summarise(a.Asset)
+		s.Neighbour = a.Neighbour
+		bySuburb[a.suburbKey] = append(bySuburb[a.suburbKey], s)
+	}
+
+	collection := newFeatureCollection()
+	for _, s := range f.Suburbs {
+		collection.Features = append(collection.Features, suburbFeature(s.SuburbInfo, s.Distance, bySuburb[s.location().Key()]))
+	}
+	return collection
+}
+
+func (f BoxFeed) geoJSON() GeoFeatureCollection {
+	collection := newFeatureCollection()
+	for _, s := range f.Suburbs {
+		collection.Features = append(collection.Features, suburbFeature(s.SuburbInfo, nil, summariseAll(s.Assets)))
+	}
+	return collection
+}
+
+func (f ClusterFeed) geoJSON() GeoFeatureCollection {
+	collection := newFeatureCollection()
+	for _, c := range f.Clusters {
+		collection.Features = append(collection.Features, pointFeature(c.Lat, c.Lon, c))
+	}
+	return collection
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultRollupAssets = 50
+
+// RollupFeed is the combined feed of every suburb in a state or region, each
+// asset appearing once.
+type RollupFeed struct {
+	Name string `json:"name"`
+	MergedFeed
+	TotalAssets int `json:"totalAssets"`
+}
+
+// RegionSummary describes a region for /newsfeed/region/.
+type RegionSummary struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	Type string `json:"type,omitempty"`
+}
+
+// rollUp merges the feeds of every suburb member accepts, dropping assets
+// already taken from an earlier suburb, and keeps the page of the assets the
+// filter lets through that paging asks for.
+func rollUp(store Store, name string, member func(SuburbInfo) bool, filter AssetFilter, paging Paging) (RollupFeed, error) {
+	records, err := store.Feeds()
+	if err != nil {
+		return RollupFeed{}, err
+	}
+
+	feed := RollupFeed{Name: name, MergedFeed: MergedFeed{Suburbs: []MergedSuburb{}, Assets: []FeedAsset{}}}
+	seen := make(map[string]bool)
+
+	for _, r := range records {
+		if !member(r.SuburbInfo) {
+			continue
+		}
+		feed.Suburbs = append(feed.Suburbs, MergedSuburb{r.SuburbInfo, nil})
+
+		for _, a := range filter.apply(r.Assets) {
+			if seen[a.ID] {
+				continue
+			}
+			seen[a.ID] = true
+			feed.Assets = append(feed.Assets, FeedAsset{Asset: a, Source: r.Name, suburbKey: r.key()})
+		}
+	}
+
+	feed.TotalAssets = len(feed.Assets)
+	feed.paginate(paging)
+	return feed, nil
+}
+
+func (s *server) writeRollup(name string, member func(SuburbInfo) bool, w http.ResponseWriter, r *http.Request) {
+	paging, apiErr := parsePaging(r.URL.Query(), defaultRollupAssets)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	filter, apiErr := parseAssetFilter(r.URL.Query(), s.clock())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	feed, err := rollUp(s.store, name, member, filter, paging)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	s.writeFeed(w, r, feed)
+}
+
+// stateHandler serves /newsfeed/state/{STATE}.
+func (s *server) stateHandler(w http.ResponseWriter, r *http.Request) {
+	state := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/newsfeed/state/"))
+	if !isState(state) {
+		writeError(w, notFound(fmt.Sprintf("no such state '%s', expected one of %s", state, strings.Join(states, ", "))))
+		return
+	}
+
+	s.writeRollup(state, func(info SuburbInfo) bool {
+		return info.State == state
+	}, w, r)
+}
+
+// regionHandler serves /newsfeed/region/{name}, or the list of regions when
+// no name is given.
+func (s *server) regionHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/newsfeed/region/")
+
+	if name == "" {
+		summaries := []RegionSummary{}
+		for _, region := range s.regions.list() {
+			summaries = append(summaries, RegionSummary{region.Name, region.slug(), region.Type})
+		}
+		writeJSON(w, summaries)
+		return
+	}
+
+	region, ok := s.regions.find(name)
+	if !ok {
+		e := notFound(fmt.Sprintf("no such region '%s'", name))
+		for _, region := range s.regions.list() {
+			e.Suggestions = append(e.Suggestions, region.slug())
+		}
+		writeError(w, e)
+		return
+	}
+
+	s.writeRollup(region.Name, region.contains, w, r)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// LookupStat counts the requests for one suburb's feed, and how many of them
+// found none.
+type LookupStat struct {
+	Suburb  SuburbInfo `json:"suburb"`
+	Lookups int        `json:"lookups"`
+	Misses  int        `json:"misses"`
+}
+
+func (s LookupStat) key() string {
+	return s.Suburb.location().Key()
+}
+
+func (s *LookupStat) add(other LookupStat) {
+	s.Suburb = other.Suburb
+	s.Lookups += other.Lookups
+	s.Misses += other.Misses
+}
+
+// LookupRecorder counts lookups in memory and adds them to the store in
+// batches, so requests don't wait on a database write.
+type LookupRecorder struct {
+	mu      sync.Mutex
+	pending map[string]LookupStat
+}
+
+func newLookupRecorder() *LookupRecorder {
+	return &LookupRecorder{pending: make(map[string]LookupStat)}
+}
+
+// record counts a lookup of loc, and whether it found a feed.
+func (r *LookupRecorder) record(loc Location, found bool) {
+	stat := LookupStat{Suburb: loc.info(), Lookups: 1}
+	if !found {
+		stat.Misses = 1
+	}
+	r.add(stat)
+}
+
+// recordLookup counts a lookup of loc, and whether it has a feed of its own.
+func (s *server) recordLookup(loc Location) {
+	_, err := feedFor(s.store, loc)
+	if _, missing := err.(*NotFoundError); err == nil || missing {
+		s.lookups.record(loc, err == nil)
+	}
+}
+
+// recordPointLookup counts a lookup of the suburb a point is in, for the
+// requests that answer from feeds around it instead of that suburb's own.
+func (s *server) recordPointLookup(lat float64, lon float64) {
+	if res, err := s.resolve(lat, lon); err == nil {
+		s.recordLookup(res.Location)
+	}
+}
+
+func (r *LookupRecorder) add(stat LookupStat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.pending[stat.key()]
+	prev.add(stat)
+	r.pending[stat.key()] = prev
+}
+
+// flush adds the pending counts to the store. They are kept for the next
+// flush if that fails.
+func (r *LookupRecorder) flush(store Store) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]LookupStat)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	stats := make([]LookupStat, 0, len(pending))
+	for _, stat := range pending {
+		stats = append(stats, stat)
+	}
+
+	if err := store.AddLookups(stats); err != nil {
+		for _, stat := range stats {
+			r.add(stat)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *LookupRecorder) flushEvery(store Store, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := r.flush(store); err != nil {
+			log.Printf("Failed to save lookup statistics: %v", err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	locationsBucket = "lat_lon"
+	feedsBucket     = "feed_data"
+	metaBucket      = "meta"
+	postcodesBucket = "postcodes"
+	lookupsBucket   = "lookups"
+)
+
+// Store holds the suburb locations and feeds served by the API. Both are
+// keyed by locationKey so suburbs sharing a name in different states are
+// kept apart.
+type Store interface {
+	// GetLocation returns the location stored under key.
+	GetLocation(key string) (Location, error)
+	// FindLocations returns every location called name that matches the
+	// state and postcode, either of which may be empty.
+	FindLocations(name string, state string, postcode string) ([]Location, error)
+	// NearestLocations returns up to k locations within radius meters of
+	// the point, closest first. Zero k or radius means no limit.
+	NearestLocations(lat, lon float64, k int, radius float64) ([]Neighbour, error)
+	// NearestFeeds is NearestLocations restricted to suburbs with a feed.
+	NearestFeeds(lat, lon float64, k int, radius float64) ([]Neighbour, error)
+	// Feeds returns every feed in key order.
+	Feeds() ([]SuburbRecord, error)
+	// FeedsInBox returns the location of every feed inside the box.
+	FeedsInBox(box BBox) ([]Location, error)
+	// GetFeed returns the feed stored under key.
+	GetFeed(key string) (SuburbRecord, error)
+	// FindFeeds is FindLocations for feeds.
+	FindFeeds(name string, state string, postcode string) ([]SuburbRecord, error)
+	// SuburbsWithPrefix returns up to limit locations and feeds whose folded
+	// name starts with the folded prefix, in key order, listing a suburb in
+	// both only once. Zero means no limit.
+	SuburbsWithPrefix(prefix string, limit int) ([]Location, error)
+	// SuburbNames returns the name of every location and feed, for fuzzy
+	// matching.
+	SuburbNames() ([]string, error)
+	// FindPostcode returns every suburb, from either the locations or the
+	// feeds, that has the postcode.
+	FindPostcode(postcode string) ([]SuburbInfo, error)
+	// PutFeed stores a feed under its record's key, replacing any previous
+	// one.
+	PutFeed(record SuburbRecord) error
+	// PutLocations makes the stored locations match the given ones in one
+	// batch and reports what changed.
+	PutLocations(locations []Location) (LocationChanges, error)
+	// AddLookups adds to the recorded lookup counts of each suburb.
+	AddLookups(stats []LookupStat) error
+	// Lookups returns the recorded lookup counts of every suburb looked up.
+	Lookups() ([]LookupStat, error)
+	// GetMeta returns bookkeeping values such as import checksums.
+	GetMeta(key string) (string, error)
+	// PutMeta stores a bookkeeping value.
+	PutMeta(key string, value string) error
+}
+
+// LocationChanges counts what a call to PutLocations did.
+type LocationChanges struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+}
+
+// mergeSuburbs combines locations from several sources in key order, up to
+// limit. Of those with the same key the first is kept. Locations with the
+// same name whose state and postcode match, where one leaves either out, are
+// the same suburb too, such as Manly NSW from lat_lon and Manly NSW 2095 from
+// its feed, and then the one that says more is kept.
+func mergeSuburbs(limit int, sets ...[]Location) []Location {
+	byKey := make(map[string]Location)
+	bySuburb := make(map[string][]string)
+
+	for _, locations := range sets {
+		for _, loc := range locations {
+			key := loc.Key()
+			if _, ok := byKey[key]; ok {
+				continue
+			}
+
+			suburb := namePrefix(loc.Name)
+			if i, ok := samePlace(byKey, bySuburb[suburb], loc); ok {
+				prev := bySuburb[suburb][i]
+				if detail(loc) > detail(byKey[prev]) {
+					delete(byKey, prev)
+					byKey[key] = loc
+					bySuburb[suburb][i] = key
+				}
+				continue
+			}
+
+			byKey[key] = loc
+			bySuburb[suburb] = append(bySuburb[suburb], key)
+		}
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	merged := make([]Location, len(keys))
+	for i, k := range keys {
+		merged[i] = byKey[k]
+	}
+	return merged
+}
+
+// samePlace finds which of the keys, all of suburbs with loc's name, is the
+// same suburb as loc. Locations told apart by their Place are never merged.
+func samePlace(byKey map[string]Location, keys []string, loc Location) (int, bool) {
+	if loc.Place != "" {
+		return 0, false
+	}
+	for i, key := range keys {
+		if other := byKey[key]; other.Place == "" && matches(other.info(), loc.State, loc.Postcode) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// detail counts the state and postcode a location has.
+func detail(loc Location) int {
+	n := 0
+	if loc.State != "" {
+		n++
+	}
+	if loc.Postcode != "" {
+		n++
+	}
+	return n
+}
+
+// locationNames lists the distinct names in each set of locations.
+func locationNames(sets ...[]Location) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, locations := range sets {
+		for _, loc := range locations {
+			if !seen[loc.Name] {
+				seen[loc.Name] = true
+				names = append(names, loc.Name)
+			}
+		}
+	}
+	return names
+}
+
+// postcodeKey orders the postcode index by postcode, then suburb.
+func postcodeKey(info SuburbInfo) string {
+	return info.Postcode + "|" + info.location().Key()
+}
+
+// GeoIndex holds an in-memory spatial index over a set of locations. It is
+// empty until the first build completes, and a rebuild only replaces the
+// tree once the new one is ready.
+type GeoIndex struct {
+	mu   sync.RWMutex
+	tree *kdTree
+}
+
+func (g *GeoIndex) search(lat, lon float64, k int, radius float64) ([]Neighbour, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.tree == nil {
+		return nil, false
+	}
+	return g.tree.search(lat, lon, k, radius), true
+}
+
+// all returns every indexed location, or nil while there is no index.
+func (g *GeoIndex) all() []Location {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.tree == nil {
+		return nil
+	}
+	return g.tree.locations
+}
+
+func (g *GeoIndex) swap(tree *kdTree) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tree = tree
+}
+
+// inBox keeps the locations inside the box.
+func inBox(box BBox, locations []Location) []Location {
+	var found []Location
+	for _, loc := range locations {
+		if box.contains(loc.Lat, loc.Lon) {
+			found = append(found, loc)
+		}
+	}
+	return found
+}
+
+// feedLocation places a feed on the map using the coordinates in its record.
+func feedLocation(record SuburbRecord) (Location, bool) {
+	if record.Lat == 0 && record.Lon == 0 {
+		return Location{}, false
+	}
+	return record.location(), true
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// eachStore runs a test against every Store implementation, each starting
+// out empty.
+func eachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		store, err := NewBoltStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, store)
+	})
+}
+
+var testLocations = []Location{
+	{Name: "Richmond", State: "VIC", Lat: -37.8233, Lon: 144.9987},
+	{Name: "Richmond", State: "NSW", Postcode: "2753", Lat: -33.5994, Lon: 150.7516},
+	{Name: "Richmond Hill", State: "NSW", Lat: -33.5833, Lon: 150.7167},
+	{Name: "St Kilda", State: "VIC", Postcode: "3182", Lat: -37.8676, Lon: 144.9809},
+	{Name: "Manly", State: "NSW", Lat: -33.7969, Lon: 151.2843},
+}
+
+func putTestLocations(t *testing.T, store Store) {
+	if _, err := store.PutLocations(testLocations); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func locationNamesOf(locations []Location) []string {
+	names := make([]string, len(locations))
+	for i, loc := range locations {
+		names[i] = loc.Name + " " + loc.State
+	}
+	return names
+}
+
+func TestStorePutLocationsChanges(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		changes, err := store.PutLocations(testLocations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (LocationChanges{Inserted: 5}); changes != want {
+			t.Errorf("first import = %+v, want %+v", changes, want)
+		}
+
+		changes, err = store.PutLocations(testLocations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (LocationChanges{}); changes != want {
+			t.Errorf("unchanged import = %+v, want %+v", changes, want)
+		}
+
+		moved := append([]Location(nil), testLocations[1:]...)
+		moved[0].Lat = -33.6
+		moved = append(moved, Location{Name: "Bondi", State: "NSW", Lat: -33.8915, Lon: 151.2767})
+
+		changes, err = store.PutLocations(moved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (LocationChanges{Inserted: 1, Updated: 1, Deleted: 1}); changes != want {
+			t.Errorf("changed import = %+v, want %+v", changes, want)
+		}
+
+		if _, err := store.GetLocation(testLocations[0].Key()); err == nil {
+			t.Errorf("deleted location %s is still stored", testLocations[0].Key())
+		}
+		loc, err := store.GetLocation(moved[0].Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Lat != -33.6 {
+			t.Errorf("updated location has lat %v, want -33.6", loc.Lat)
+		}
+	})
+}
+
+func TestStoreFindLocationsAmbiguous(t *testing.T) {
+	tests := []struct {
+		name, state, postcode string
+		want                  []string
+	}{
+		{"Richmond", "", "", []string{"Richmond NSW", "Richmond VIC"}},
+		{"richmond", "vic", "", []string{"Richmond VIC"}},
+		// Richmond VIC has no postcode, so it can't be ruled out by one.
+		{"Richmond", "", "2753", []string{"Richmond NSW", "Richmond VIC"}},
+		{"Richmond", "", "3121", []string{"Richmond VIC"}},
+		{"Richmond", "NSW", "2753", []string{"Richmond NSW"}},
+		{"Saint Kilda", "", "", []string{"St Kilda VIC"}},
+		{"Richmond", "QLD", "", []string{}},
+	}
+
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+
+		for _, test := range tests {
+			found, err := store.FindLocations(test.name, test.state, test.postcode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := locationNamesOf(found); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("FindLocations(%q, %q, %q) = %v, want %v", test.name, test.state, test.postcode, got, test.want)
+			}
+		}
+	})
+}
+
+func TestStoreFindFeeds(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		for _, info := range []SuburbInfo{
+			{Name: "Richmond", State: "VIC", Postcode: "3121"},
+			{Name: "Richmond", State: "NSW", Postcode: "2753"},
+		} {
+			if err := store.PutFeed(SuburbRecord{SuburbInfo: info}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, err := store.FindFeeds("Richmond", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 || records[0].State != "NSW" || records[1].State != "VIC" {
+			t.Errorf("FindFeeds(Richmond) = %+v, want NSW then VIC", records)
+		}
+	})
+}
+
+func TestStoreFindPostcode(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+		feed := SuburbRecord{SuburbInfo: SuburbInfo{Name: "Manly", State: "NSW", Postcode: "2095"}}
+		if err := store.PutFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+
+		for postcode, want := range map[string][]string{
+			"3182": {"St Kilda"},
+			"2095": {"Manly"},
+			"9999": nil,
+		} {
+			found, err := store.FindPostcode(postcode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, info := range found {
+				got = append(got, info.Name)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FindPostcode(%s) = %v, want %v", postcode, got, want)
+			}
+		}
+	})
+}
+
+func TestStoreSuburbsWithPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"rich", 0, []string{"Richmond Hill NSW", "Richmond NSW", "Richmond VIC"}},
+		{"Rich", 2, []string{"Richmond Hill NSW", "Richmond NSW"}},
+		{"saint", 0, []string{"St Kilda VIC"}},
+		{"zz", 0, []string{}},
+	}
+
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+
+		for _, test := range tests {
+			found, err := store.SuburbsWithPrefix(test.prefix, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := locationNamesOf(found); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SuburbsWithPrefix(%q, %d) = %v, want %v", test.prefix, test.limit, got, test.want)
+			}
+		}
+	})
+}
+
+func TestStoreSuburbsWithPrefixMergesFeeds(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+		for _, info := range []SuburbInfo{
+			{Name: "Manly", State: "NSW", Postcode: "2095", Lat: -33.7971, Lon: 151.2880},
+			{Name: "Richmond", State: "QLD", Postcode: "4740"},
+		} {
+			if err := store.PutFeed(SuburbRecord{SuburbInfo: info}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		found, err := store.SuburbsWithPrefix("man", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].Postcode != "2095" || found[0].Lat != -33.7971 {
+			t.Errorf("SuburbsWithPrefix(man) = %+v, want only the feed's Manly NSW 2095", found)
+		}
+
+		found, err = store.SuburbsWithPrefix("richmond", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := locationNamesOf(found), []string{"Richmond Hill NSW", "Richmond NSW", "Richmond QLD", "Richmond VIC"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("SuburbsWithPrefix(richmond) = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestStorePutFeedIndexes(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+		feed := SuburbRecord{SuburbInfo: SuburbInfo{Name: "Manly", State: "NSW", Postcode: "2095", Lat: -33.7971, Lon: 151.2880}}
+		if err := store.PutFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+
+		// Rewriting the assets keeps the suburb indexed; moving it moves it.
+		feed.Assets = []Asset{{ID: "1"}}
+		if err := store.PutFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+		feed.Lat, feed.Lon = -33.8915, 151.2767
+		if err := store.PutFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+
+		nearest, err := store.NearestFeeds(-33.8915, 151.2767, 1, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nearest) != 1 || nearest[0].Name != "Manly" {
+			t.Errorf("NearestFeeds at the moved feed = %+v, want Manly", nearest)
+		}
+
+		found, err := store.FindPostcode("2095")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].Lat != -33.8915 {
+			t.Errorf("FindPostcode(2095) = %+v, want the moved Manly", found)
+		}
+	})
+}
+
+func TestStoreSuburbsWithPrefixLimitsMerged(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		putTestLocations(t, store)
+		// Manly NSW is in both buckets, and twice among the feeds.
+		for _, info := range []SuburbInfo{
+			{Name: "Manly", State: "NSW"},
+			{Name: "Manly", State: "NSW", Postcode: "2095"},
+			{Name: "Manly", State: "QLD", Postcode: "4179"},
+		} {
+			if err := store.PutFeed(SuburbRecord{SuburbInfo: info}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		found, err := store.SuburbsWithPrefix("man", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := locationNamesOf(found), []string{"Manly NSW", "Manly QLD"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("SuburbsWithPrefix(man, 2) = %v, want %v", got, want)
+		}
+	})
+}
@@ -11,5 +11,7 @@ type SuburbInfo struct {
 	Postcode string  `json:"postcode"`
 	Lat      float64 `json:"lat"`
 	Lon      float64 `json:"lon"`
+	// Place tells apart suburbs that share a name, state and postcode, as
+	// Location.Place does.
+	Place string `json:"place,omitempty"`
 }
-
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultAutocompleteLimit = 10
+	maxAutocompleteLimit     = 50
+
+	// maxRankedCandidates bounds how many prefix matches are ranked by
+	// proximity when the caller gives a location.
+	maxRankedCandidates = 5000
+)
+
+// SuburbMatch is a suburb offered by autocomplete.
+type SuburbMatch struct {
+	SuburbInfo
+	HasFeed  bool     `json:"hasFeed"`
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+// Autocomplete is the response of /suburbs/autocomplete.
+type Autocomplete struct {
+	Query   string        `json:"query"`
+	Suburbs []SuburbMatch `json:"suburbs"`
+}
+
+// suburbsHandler serves the /suburbs/ endpoints.
+func (s *server) suburbsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/suburbs/")
+
+	switch {
+	case path == "autocomplete":
+		s.autocompleteHandler(w, r)
+	case strings.HasSuffix(path, "/neighbours"):
+		s.neighboursHandler(strings.TrimSuffix(path, "/neighbours"), w, r)
+	default:
+		writeError(w, notFound(fmt.Sprintf("no such endpoint '%s'", r.URL.Path)))
+	}
+}
+
+// autocompleteHandler suggests suburbs whose name starts with q, in name
+// order or, when lat and lon are given, closest first.
+func (s *server) autocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := query.Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeError(w, missingParameter("q", "q is required, e.g. q=pyr"))
+		return
+	}
+
+	limit, apiErr := parseBounded(query, "limit", maxAutocompleteLimit)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if limit == 0 {
+		limit = defaultAutocompleteLimit
+	}
+
+	ranked := hasCoordinates(query)
+	var lat, lon float64
+	if ranked {
+		if lat, lon, apiErr = parseCoordinates(query); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+	}
+
+	scan := limit
+	if ranked {
+		scan = maxRankedCandidates
+	}
+
+	locations, err := s.store.SuburbsWithPrefix(q, scan)
+	if err != nil {
+		writeError(w, lookupError(err))
+		return
+	}
+
+	matches := make([]SuburbMatch, len(locations))
+	for i, loc := range locations {
+		matches[i] = SuburbMatch{SuburbInfo: loc.info()}
+		if ranked {
+			d := distance(lat, lon, loc.Lat, loc.Lon)
+			matches[i].Distance = &d
+		}
+	}
+
+	if ranked {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return *matches[i].Distance < *matches[j].Distance
+		})
+	}
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	for i := range matches {
+		_, err := feedFor(s.store, matches[i].location())
+		matches[i].HasFeed = err == nil
+	}
+
+	writeJSON(w, Autocomplete{q, matches})
+}
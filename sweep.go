@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// clock tells the time. It is passed in, rather than calling time.Now, so
+// tests can fix it.
+type clock func() time.Time
+
+// sweepExpired removes the assets due to be taken down by now from every
+// stored feed, returning how many were removed.
+func sweepExpired(store Store, now time.Time) (int, error) {
+	records, err := store.Feeds()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, r := range records {
+		kept := []Asset{}
+		var ids []string
+		for _, a := range r.Assets {
+			if expired(a, now) {
+				ids = append(ids, a.ID)
+			} else {
+				kept = append(kept, a)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		r.Assets = kept
+		if err := store.PutFeed(r); err != nil {
+			return removed, err
+		}
+		log.Printf("Removed %d expired assets from '%s': %s", len(ids), r.key(), strings.Join(ids, ", "))
+		removed += len(ids)
+	}
+	return removed, nil
+}
+
+// sweepEvery sweeps the feeds straight away, since those just loaded may
+// hold expired assets, and then every interval.
+func sweepEvery(store Store, interval time.Duration, now clock) {
+	tick := time.Tick(interval)
+	for {
+		if _, err := sweepExpired(store, now()); err != nil {
+			log.Printf("Failed to remove expired assets: %v", err)
+		}
+		<-tick
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSweepExpired(t *testing.T) {
+	store := NewMemoryStore()
+	manly := SuburbRecord{
+		SuburbInfo: SuburbInfo{Name: "Manly", State: "NSW", Postcode: "2095"},
+		Assets: []Asset{
+			{ID: "kept"},
+			{ID: "later", Dates: AssetDates{TimeToTakeDown: timeAt(time.Second)}},
+			{ID: "due", Dates: AssetDates{TimeToTakeDown: timeAt(0)}},
+			{ID: "past", Dates: AssetDates{TimeToTakeDown: timeAt(-time.Hour)}},
+		},
+	}
+	pyrmont := SuburbRecord{
+		SuburbInfo: SuburbInfo{Name: "Pyrmont", State: "NSW", Postcode: "2009"},
+		Assets:     []Asset{{ID: "untouched"}},
+	}
+	for _, r := range []SuburbRecord{manly, pyrmont} {
+		if err := store.PutFeed(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := clock(func() time.Time { return testNow })
+	removed, err := sweepExpired(store, now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d assets, want 2", removed)
+	}
+
+	for key, want := range map[string][]string{
+		manly.key():   {"kept", "later"},
+		pyrmont.key(): {"untouched"},
+	} {
+		record, err := store.GetFeed(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, a := range record.Assets {
+			ids = append(ids, a.ID)
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("'%s' kept %v, want %v", key, ids, want)
+		}
+	}
+
+	// A second sweep at the same time has nothing left to remove.
+	if removed, err := sweepExpired(store, now()); err != nil || removed != 0 {
+		t.Errorf("second sweep removed %d, %v, want 0", removed, err)
+	}
+}